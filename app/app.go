@@ -7,11 +7,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rawdaGastan/pkid/config"
+	"github.com/rawdaGastan/pkid/metrics"
 	"github.com/rawdaGastan/pkid/middlewares"
 	"github.com/rawdaGastan/pkid/store"
 	"github.com/rs/zerolog/log"
@@ -21,50 +23,141 @@ import (
 type App struct {
 	config config.Configuration
 	db     store.PkidStore
+	nonces *nonceCache
+	// metrics are the prometheus metrics served on /metrics
+	metrics *metrics.Metrics
+	// counts are the stored keys and projects reported in the metrics, they are counted again by the sweeper
+	counts *storeCollector
+	// certs is the reloadable server certificate, it is nil if tls is disabled
+	certs *certReloader
+	// draining is set when the server is shutting down, /readyz fails then
+	draining atomic.Bool
+	// now is the clock of the expiry of set documents
+	now func() time.Time
 }
 
-// NewApp creates new server app all configurations
-func NewApp(ctx context.Context, configFile string) (app *App, err error) {
-	config, err := config.ReadConfFile(configFile)
+// NewApp creates new server app of the given configurations
+func NewApp(ctx context.Context, config config.Configuration) (app *App, err error) {
+	pkidMetrics := metrics.NewMetrics()
+
+	driverStore, conn := newStore(config)
+	pkidStore := store.NewInstrumentedStore(driverStore, config.DBDriver, pkidMetrics)
+	err = pkidStore.SetConn(conn)
+	if err != nil {
+		return
+	}
+	pkidStore.SetHistoryLimit(config.HistoryRetention)
+
+	counts := newStoreCollector(pkidStore)
+	err = pkidMetrics.Register(counts)
 	if err != nil {
 		return
 	}
 
-	pkidStore := store.NewSqliteStore()
-	err = pkidStore.SetConn(config.DBFile)
+	nonces := newNonceCache(time.Duration(config.ClockSkew)*time.Second, config.MaxNonces)
+	err = pkidMetrics.Register(newNonceCollector(nonces))
 	if err != nil {
 		return
 	}
 
-	if err = pkidStore.Migrate(); err != nil {
+	if err = pkidStore.Migrate(ctx); err != nil {
 		return
 	}
 
+	countCtx, cancel := context.WithTimeout(ctx, time.Duration(config.DBTimeout)*time.Second)
+	defer cancel()
+	counts.refresh(countCtx)
+
+	var certs *certReloader
+	if config.TLS.Enabled() {
+		certs, err = newCertReloader(config.TLS)
+		if err != nil {
+			return
+		}
+	}
+
 	return &App{
-		config: config,
-		db:     pkidStore,
+		config:  config,
+		db:      pkidStore,
+		nonces:  nonces,
+		metrics: pkidMetrics,
+		counts:  counts,
+		certs:   certs,
+		now:     time.Now,
 	}, nil
 }
 
+// newStore creates the store of the configured database driver with its connection
+func newStore(conf config.Configuration) (store.PkidStore, string) {
+	switch conf.DBDriver {
+	case config.DriverPostgres:
+		return store.NewPostgresStore(), conf.DBDSN
+	case config.DriverBolt:
+		return store.NewBoltStore(), conf.DBFile
+	case config.DriverMemory:
+		return store.NewMemoryStore(), ""
+	default:
+		return store.NewSqliteStore(), conf.DBFile
+	}
+}
+
+// rateLimits gets the rate limiting middleware budgets of the configured rate limits
+func rateLimits(conf config.RateLimits) middlewares.RateLimits {
+	limit := func(l config.RateLimit) middlewares.Limit {
+		return middlewares.Limit{Rate: l.Rate, Burst: l.Burst}
+	}
+
+	return middlewares.RateLimits{
+		IPRead:            limit(conf.IPRead),
+		IPWrite:           limit(conf.IPWrite),
+		PkRead:            limit(conf.PkRead),
+		PkWrite:           limit(conf.PkWrite),
+		MaxClients:        conf.MaxClients,
+		TrustForwardedFor: conf.TrustForwardedFor,
+	}
+}
+
 // Start starts the app
 func (a *App) Start(ctx context.Context) (err error) {
-	a.registerHandlers()
 	log.Info().Msgf("Server is listening on port %s", a.config.Port)
 
 	srv := &http.Server{
-		Addr: a.config.Port,
+		Addr:    a.config.Port,
+		Handler: a.router(),
+	}
+
+	if a.certs != nil {
+		srv.TLSConfig = tlsConfig(a.certs)
 	}
 
+	ticker := time.NewTicker(time.Duration(a.config.SweepInterval) * time.Second)
+	defer ticker.Stop()
+	sweeper := a.startSweeper(ticker.C)
+
 	go func() {
-		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		if err := a.serve(srv); !errors.Is(err, http.ErrServerClosed) {
 			log.Fatal().Err(err).Msg("HTTP server error")
 		}
 		log.Info().Msg("Stopped serving new connections")
 	}()
 
+	// SIGHUP reloads the certificate, it keeps its default behavior when TLS is off
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	if a.certs != nil {
+		signals = append(signals, syscall.SIGHUP)
+	}
+
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, signals...)
+	for sig := <-sigChan; sig == syscall.SIGHUP; sig = <-sigChan {
+		a.reloadCertificate()
+	}
+
+	a.draining.Store(true)
+	if a.config.ShutdownDelay > 0 {
+		log.Info().Msgf("Draining traffic for %d seconds before shutdown", a.config.ShutdownDelay)
+		time.Sleep(time.Duration(a.config.ShutdownDelay) * time.Second)
+	}
 
 	shutdownCtx, shutdownRelease := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownRelease()
@@ -72,23 +165,78 @@ func (a *App) Start(ctx context.Context) (err error) {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Fatal().Err(err).Msg("HTTP shutdown error")
 	}
+	sweeper.stop()
 	log.Info().Msg("Graceful shutdown complete")
 
 	return nil
 }
 
-func (a *App) registerHandlers() {
+// serve serves the api over https if tls is enabled
+func (a *App) serve(srv *http.Server) error {
+	if a.certs != nil {
+		// the certificate is given by the tls configurations
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// reloadCertificate reloads the tls certificate and the client CA bundle, the current ones are kept if it fails
+func (a *App) reloadCertificate() {
+	if a.certs == nil {
+		return
+	}
+
+	if err := a.certs.reload(); err != nil {
+		log.Error().Err(err).Msg("failed to reload tls certificates")
+		return
+	}
+	log.Info().Msg("TLS certificates are reloaded")
+}
+
+// router registers the handlers of the api with their middlewares
+func (a *App) router() *mux.Router {
 	r := mux.NewRouter()
 
+	// the probes and the metrics are not limited like the api
+	r.Handle("/metrics", a.metrics.Handler()).Methods("GET")
+	r.HandleFunc("/healthz", WrapFunc(a.healthz)).Methods("GET")
+	r.HandleFunc("/readyz", WrapFunc(a.readyz)).Methods("GET")
+
 	versionRouter := r.PathPrefix("/" + a.config.Version).Subrouter()
 
+	versionRouter.HandleFunc("/{pk}/{project}/_batch", WrapFunc(a.batchSet)).Methods("POST", "OPTIONS")
+	versionRouter.HandleFunc("/{pk}/{project}/_batch", WrapFunc(a.batchGet)).Methods("GET", "OPTIONS")
 	versionRouter.HandleFunc("/{pk}/{project}/{key}", WrapFunc(a.set)).Methods("POST", "OPTIONS")
 	versionRouter.HandleFunc("/{pk}/{project}/{key}", WrapFunc(a.get)).Methods("GET", "OPTIONS")
+	versionRouter.HandleFunc("/{pk}/_usage", WrapFunc(a.usage)).Methods("GET", "OPTIONS")
+	versionRouter.HandleFunc("/{pk}", WrapFunc(a.projects)).Methods("GET", "OPTIONS")
 	versionRouter.HandleFunc("/{pk}/{project}", WrapFunc(a.list)).Methods("GET", "OPTIONS")
 	versionRouter.HandleFunc("/{pk}/{project}", WrapFunc(a.deleteProject)).Methods("DELETE", "OPTIONS")
 	versionRouter.HandleFunc("/{pk}/{project}/{key}", WrapFunc(a.delete)).Methods("DELETE", "OPTIONS")
+	versionRouter.HandleFunc("/{pk}/{project}/{key}/history", WrapFunc(a.history)).Methods("GET", "OPTIONS")
+	versionRouter.HandleFunc("/{pk}/{project}/{key}/restore", WrapFunc(a.restore)).Methods("POST", "OPTIONS")
 
 	// middlewares
-	r.Use(middlewares.EnableCors)
-	http.Handle("/", r)
+	r.Use(middlewares.Metrics(a.metrics))
+	r.Use(middlewares.Logging)
+
+	// requests that match no route don't go through the router middlewares, so they are wrapped with them here
+	unmatched := func(h http.Handler) http.Handler {
+		return middlewares.Metrics(a.metrics)(middlewares.Logging(h))
+	}
+	r.NotFoundHandler = unmatched(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = unmatched(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}))
+	versionRouter.Use(middlewares.Cors(middlewares.CorsPolicy{
+		AllowedOrigins:   a.config.Cors.AllowedOrigins,
+		AllowedMethods:   a.config.Cors.AllowedMethods,
+		AllowedHeaders:   a.config.Cors.AllowedHeaders,
+		ExposedHeaders:   a.config.Cors.ExposedHeaders,
+		MaxAge:           a.config.Cors.MaxAge,
+		AllowCredentials: a.config.Cors.AllowCredentials,
+	}))
+	versionRouter.Use(middlewares.Timeout(time.Duration(a.config.DBTimeout) * time.Second))
+	versionRouter.Use(middlewares.NewRateLimiter(rateLimits(a.config.RateLimits)).Limit)
+	return r
 }
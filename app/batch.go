@@ -0,0 +1,168 @@
+// Package app for pkid app
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rawdaGastan/pkid/pkg"
+	"github.com/rawdaGastan/pkid/store"
+)
+
+// maxBatchSize is the max number of documents that can be set or got by one batch request
+const maxBatchSize = 100
+
+// batchDocumentMsg is a signed value of a key in a batch request or response
+type batchDocumentMsg struct {
+	Key      string `json:"key"`
+	Revision int64  `json:"revision,omitempty"`
+	Data     string `json:"data,omitempty"`
+}
+
+// batchSetReq is the body of a batch set request
+type batchSetReq struct {
+	Documents []batchDocumentMsg `json:"documents"`
+}
+
+// checkBatchSize checks that a batch has documents and that it is not larger than maxBatchSize
+func checkBatchSize(size int) Response {
+	if size == 0 {
+		return BadRequest(errors.New("no documents are provided"))
+	}
+
+	if size > maxBatchSize {
+		return BadRequest(fmt.Errorf("batch has %d documents, the limit is %d", size, maxBatchSize)).
+			WithCode(pkg.CodeBatchTooLarge).
+			WithDetails(map[string]interface{}{"limit": maxBatchSize})
+	}
+
+	return nil
+}
+
+// batchGet gets the documents of the given keys of a project, keys that don't exist are left out
+func (a *App) batchGet(r *http.Request) (interface{}, Response) {
+	pk := mux.Vars(r)["pk"]
+	project := mux.Vars(r)["project"]
+	keys := r.URL.Query()["key"]
+
+	if res := checkBatchSize(len(keys)); res != nil {
+		return nil, res
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			return nil, BadRequest(errors.New("a key is required for each key parameter"))
+		}
+	}
+
+	docs := make([]batchDocumentMsg, 0, len(keys))
+	for _, key := range keys {
+		doc, err := a.db.Get(r.Context(), store.DocKey{Pk: pk, Project: project, Key: key})
+		if errors.Is(err, store.ErrNotExists) {
+			continue
+		}
+		if err != nil {
+			return nil, storeError(r.Context(), err, InternalServerError(errors.New("database get failed")))
+		}
+
+		docs = append(docs, batchDocumentMsg{Key: key, Revision: doc.Revision, Data: doc.Value})
+	}
+
+	return ResponseMsg{
+		Message: "data is got successfully",
+		Data:    docs,
+	}, Ok()
+}
+
+// batchSet sets the given values of several keys of a project, all of them are set or none of them
+func (a *App) batchSet(r *http.Request) (interface{}, Response) {
+	pk := mux.Vars(r)["pk"]
+	project := mux.Vars(r)["project"]
+
+	if res := validateNames(project); res != nil {
+		return nil, res
+	}
+
+	body, res := a.readBody(r)
+	if res != nil {
+		return nil, res
+	}
+
+	var req batchSetReq
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, BadRequest(errors.New("invalid batch body"))
+	}
+
+	if res := checkBatchSize(len(req.Documents)); res != nil {
+		return nil, res
+	}
+
+	verifyPk, res := decodePublicKey(r.Context(), pk)
+	if res != nil {
+		return nil, res
+	}
+
+	if r.Header.Get("Authorization") == "" {
+		a.metrics.SignatureFailure(reasonMissingHeader)
+		return nil, UnAuthorized(errors.New(("no Authorization is provided"))).WithCode(pkg.CodeAuthorizationMissing)
+	}
+
+	docs := make([]store.Document, 0, len(req.Documents))
+	sizes := make(map[string]int64, len(req.Documents))
+	for _, doc := range req.Documents {
+		details := map[string]interface{}{"key": doc.Key}
+
+		if doc.Key == "" {
+			return nil, BadRequest(errors.New("a key is required for each document"))
+		}
+
+		if res := validateNames(doc.Key); res != nil {
+			return nil, res
+		}
+
+		if _, ok := sizes[doc.Key]; ok {
+			return nil, BadRequest(fmt.Errorf("key %s is duplicated", doc.Key)).WithDetails(details)
+		}
+
+		opened, res := a.openDocument(r.Context(), doc.Data, verifyPk)
+		if res != nil {
+			return nil, res.WithDetails(details)
+		}
+
+		sizes[doc.Key] = int64(len(doc.Data))
+		opened.DocKey = store.DocKey{Pk: pk, Project: project, Key: doc.Key}
+		opened.Value = doc.Data
+		docs = append(docs, opened)
+	}
+
+	res = a.authorize(r, verifyPk, signedRequest{
+		intent:  intentBatch,
+		project: project,
+		body:    body,
+	})
+	if res != nil {
+		return nil, res
+	}
+
+	if res := a.checkProjectQuota(r.Context(), pk, project, sizes); res != nil {
+		return nil, res
+	}
+
+	revisions, err := a.db.SetMany(r.Context(), docs)
+	if err != nil {
+		return nil, storeError(r.Context(), err, InternalServerError(errors.New(("database set failed"))))
+	}
+
+	written := make([]batchDocumentMsg, 0, len(docs))
+	for i, doc := range docs {
+		written = append(written, batchDocumentMsg{Key: doc.Key, Revision: revisions[i]})
+	}
+
+	return ResponseMsg{
+		Message: "data is set successfully",
+		Data:    written,
+	}, Created()
+}
@@ -0,0 +1,180 @@
+// Package app for pkid app
+package app
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rawdaGastan/pkid/client"
+	"github.com/rawdaGastan/pkid/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchSetRequest creates a signed batch set request of the given documents
+func batchSetRequest(t testing.TB, privateKey, publicKey []byte, project string, docs []batchDocumentMsg) *http.Request {
+	body, err := json.Marshal(batchSetReq{Documents: docs})
+	assert.NoError(t, err)
+
+	requestURL := fmt.Sprintf("/v1/%v/%v/_batch", hex.EncodeToString(publicKey), project)
+	req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader(body))
+	req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentBatch, project, "", body))
+
+	return req
+}
+
+func TestBatch(t *testing.T) {
+	privateKey, publicKey, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	app := setUpWithConfig(t, `{
+		"port": ":3000",
+		"version": "v1",
+		"db_driver": "memory",
+		"max_keys_per_project": 3
+	}`)
+	router := app.router()
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	batchGet := func(keys ...string) []batchDocumentMsg {
+		requestURL := fmt.Sprintf("/v1/%v/pkid/_batch?%s", hex.EncodeToString(publicKey), url.Values{"key": keys}.Encode())
+		response := serve(httptest.NewRequest(http.MethodGet, requestURL, nil))
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var body struct {
+			Data []batchDocumentMsg `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		return body.Data
+	}
+
+	t.Run("test batch set", func(t *testing.T) {
+		response := serve(batchSetRequest(t, privateKey, publicKey, "pkid", []batchDocumentMsg{
+			{Key: "a", Data: signedPayload(t, privateKey, "a")},
+			{Key: "b", Data: signedPayload(t, privateKey, "b")},
+		}))
+		assert.Equal(t, http.StatusCreated, response.Code)
+
+		var body struct {
+			Data []batchDocumentMsg `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		assert.Equal(t, []batchDocumentMsg{{Key: "a", Revision: 1}, {Key: "b", Revision: 1}}, body.Data)
+	})
+
+	t.Run("test batch get", func(t *testing.T) {
+		docs := batchGet("b", "missing", "a")
+		assert.Len(t, docs, 2)
+		assert.Equal(t, "b", docs[0].Key)
+		assert.Equal(t, "a", docs[1].Key)
+		assert.Equal(t, int64(1), docs[1].Revision)
+
+		payload, err := verifySignedData(docs[1].Data, publicKey)
+		assert.NoError(t, err)
+		assert.Contains(t, string(payload), `"payload":"a"`)
+	})
+
+	t.Run("test batch get no keys", func(t *testing.T) {
+		response := serve(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/%v/pkid/_batch", hex.EncodeToString(publicKey)), nil))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("test batch get empty key", func(t *testing.T) {
+		response := serve(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/%v/pkid/_batch?key=a&key=", hex.EncodeToString(publicKey)), nil))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("test batch set invalid document", func(t *testing.T) {
+		otherPrivateKey, _, err := client.GenerateKeyPair()
+		assert.NoError(t, err)
+
+		response := serve(batchSetRequest(t, privateKey, publicKey, "pkid", []batchDocumentMsg{
+			{Key: "a", Data: signedPayload(t, privateKey, "new")},
+			{Key: "c", Data: signedPayload(t, otherPrivateKey, "c")},
+		}))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+
+		var body ErrorMsg
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		assert.Equal(t, pkg.CodeSignatureInvalid, body.Code)
+		assert.Equal(t, "c", body.Details["key"])
+
+		docs := batchGet("a", "c")
+		assert.Len(t, docs, 1)
+		assert.Equal(t, int64(1), docs[0].Revision)
+	})
+
+	t.Run("test batch set duplicated key", func(t *testing.T) {
+		response := serve(batchSetRequest(t, privateKey, publicKey, "pkid", []batchDocumentMsg{
+			{Key: "a", Data: signedPayload(t, privateKey, "a")},
+			{Key: "a", Data: signedPayload(t, privateKey, "a")},
+		}))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("test batch set reserved key", func(t *testing.T) {
+		response := serve(batchSetRequest(t, privateKey, publicKey, "pkid", []batchDocumentMsg{
+			{Key: "_batch", Data: signedPayload(t, privateKey, "a")},
+		}))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, pkg.CodeInvalidName, errorCode(t, response))
+	})
+
+	t.Run("test batch set too large", func(t *testing.T) {
+		docs := make([]batchDocumentMsg, maxBatchSize+1)
+		for i := range docs {
+			docs[i] = batchDocumentMsg{Key: fmt.Sprint(i), Data: "data"}
+		}
+
+		response := serve(batchSetRequest(t, privateKey, publicKey, "pkid", docs))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, pkg.CodeBatchTooLarge, errorCode(t, response))
+	})
+
+	t.Run("test batch set no auth", func(t *testing.T) {
+		req := batchSetRequest(t, privateKey, publicKey, "pkid", []batchDocumentMsg{
+			{Key: "c", Data: signedPayload(t, privateKey, "c")},
+		})
+		req.Header.Del("Authorization")
+
+		response := serve(req)
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		assert.Equal(t, pkg.CodeAuthorizationMissing, errorCode(t, response))
+	})
+
+	t.Run("test batch set header bound to other body", func(t *testing.T) {
+		req := batchSetRequest(t, privateKey, publicKey, "pkid", []batchDocumentMsg{
+			{Key: "c", Data: signedPayload(t, privateKey, "c")},
+		})
+		other := batchSetRequest(t, privateKey, publicKey, "pkid", []batchDocumentMsg{
+			{Key: "d", Data: signedPayload(t, privateKey, "d")},
+		})
+		req.Header.Set("Authorization", other.Header.Get("Authorization"))
+
+		response := serve(req)
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		assert.Equal(t, pkg.CodeHeaderInvalid, errorCode(t, response))
+	})
+
+	t.Run("test batch set keys quota", func(t *testing.T) {
+		response := serve(batchSetRequest(t, privateKey, publicKey, "pkid", []batchDocumentMsg{
+			{Key: "a", Data: signedPayload(t, privateKey, "a")},
+			{Key: "c", Data: signedPayload(t, privateKey, "c")},
+			{Key: "d", Data: signedPayload(t, privateKey, "d")},
+		}))
+		assert.Equal(t, http.StatusTooManyRequests, response.Code)
+		assert.Equal(t, pkg.CodeKeysQuotaExceeded, errorCode(t, response))
+
+		assert.Len(t, batchGet("a", "b", "c", "d"), 2)
+	})
+}
@@ -0,0 +1,52 @@
+// Package app for pkid app
+package app
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rawdaGastan/pkid/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	app := setUp(t)
+	server := httptest.NewServer(app.router())
+	t.Cleanup(server.Close)
+
+	privateKey, publicKey, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	pkidClient := client.NewPkidClient(privateKey, publicKey, server.URL+"/v1", 5*time.Second)
+
+	t.Run("test set and get", func(t *testing.T) {
+		assert.NoError(t, pkidClient.Set("pkid", "key", "value", false))
+
+		value, err := pkidClient.Get("pkid", "key")
+		assert.NoError(t, err)
+		assert.Equal(t, "value", value)
+	})
+
+	t.Run("test delete", func(t *testing.T) {
+		assert.NoError(t, pkidClient.Delete("pkid", "key"))
+
+		_, err := pkidClient.Get("pkid", "key")
+		assert.True(t, errors.Is(err, client.ErrNotFound))
+	})
+
+	t.Run("test delete missing key", func(t *testing.T) {
+		err := pkidClient.Delete("pkid", "key")
+		assert.True(t, errors.Is(err, client.ErrNotFound), "got %v", err)
+	})
+
+	t.Run("test delete project", func(t *testing.T) {
+		assert.NoError(t, pkidClient.Set("pkid", "key", "value", false))
+		assert.NoError(t, pkidClient.DeleteProject("pkid"))
+
+		keys, err := pkidClient.List("pkid")
+		assert.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+}
@@ -0,0 +1,105 @@
+// Package app for pkid app
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rawdaGastan/pkid/store"
+)
+
+// errUnsupportedDataVersion is an error of an envelope of a data version that can't be stored
+var errUnsupportedDataVersion = errors.New("unsupported data_version")
+
+// maxExpiry is the latest expiry of a document, the stores keep it as unix nanoseconds
+var maxExpiry = time.Unix(0, math.MaxInt64)
+
+// supportedDataVersions are the versions of the signed payload envelope that can be stored
+var supportedDataVersions = []int{1}
+
+// envelope is the signed payload of a set request, fields are pointers to detect the missing ones
+type envelope struct {
+	IsEncrypted *bool   `json:"is_encrypted"`
+	Payload     *string `json:"payload"`
+	DataVersion *int    `json:"data_version"`
+	// TTL is the optional time to live of the document in seconds
+	TTL *int64 `json:"ttl"`
+	// ExpiresAt is the optional unix time in seconds the document expires at, it can't be given with TTL
+	ExpiresAt *int64 `json:"expires_at"`
+}
+
+// parseEnvelope decodes and validates the signed payload envelope of a set request and gets the document
+// of its metadata and expiry, the time to live starts at the given time
+func parseEnvelope(payload []byte, now time.Time) (store.Document, error) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return store.Document{}, fmt.Errorf("invalid payload envelope: %s should be a %s", typeErr.Field, typeErr.Type)
+		}
+		return store.Document{}, errors.New("invalid payload envelope: it should be a json object")
+	}
+
+	switch {
+	case env.IsEncrypted == nil:
+		return store.Document{}, errors.New("invalid payload envelope: is_encrypted is required")
+	case env.Payload == nil:
+		return store.Document{}, errors.New("invalid payload envelope: payload is required")
+	case env.DataVersion == nil:
+		return store.Document{}, errors.New("invalid payload envelope: data_version is required")
+	}
+
+	if !isSupportedDataVersion(*env.DataVersion) {
+		return store.Document{}, fmt.Errorf("%w %d, supported versions are %v", errUnsupportedDataVersion, *env.DataVersion, supportedDataVersions)
+	}
+
+	expiresAt, err := env.expiresAt(now)
+	if err != nil {
+		return store.Document{}, err
+	}
+
+	return store.Document{
+		Envelope: store.Envelope{IsEncrypted: *env.IsEncrypted, DataVersion: *env.DataVersion},
+		Metadata: store.Metadata{ExpiresAt: expiresAt},
+	}, nil
+}
+
+// expiresAt gets the expiry of the envelope from its time to live or expiry time, it is the zero time if it never expires
+func (env envelope) expiresAt(now time.Time) (time.Time, error) {
+	switch {
+	case env.TTL != nil && env.ExpiresAt != nil:
+		return time.Time{}, errors.New("invalid payload envelope: ttl and expires_at can't be given together")
+	case env.TTL != nil:
+		if *env.TTL <= 0 {
+			return time.Time{}, errors.New("invalid payload envelope: ttl should be positive")
+		}
+		if *env.TTL > int64(maxExpiry.Sub(now)/time.Second) {
+			return time.Time{}, fmt.Errorf("invalid payload envelope: ttl should expire before %s", maxExpiry.UTC().Format(time.RFC3339))
+		}
+		return now.Add(time.Duration(*env.TTL) * time.Second), nil
+	case env.ExpiresAt != nil:
+		if *env.ExpiresAt > maxExpiry.Unix() {
+			return time.Time{}, fmt.Errorf("invalid payload envelope: expires_at should be before %s", maxExpiry.UTC().Format(time.RFC3339))
+		}
+
+		expiresAt := time.Unix(*env.ExpiresAt, 0)
+		if !expiresAt.After(now) {
+			return time.Time{}, errors.New("invalid payload envelope: expires_at should be in the future")
+		}
+		return expiresAt, nil
+	}
+	return time.Time{}, nil
+}
+
+// isSupportedDataVersion checks that the envelope data version can be stored
+func isSupportedDataVersion(version int) bool {
+	for _, supported := range supportedDataVersions {
+		if version == supported {
+			return true
+		}
+	}
+	return false
+}
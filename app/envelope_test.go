@@ -0,0 +1,73 @@
+// Package app for pkid app
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rawdaGastan/pkid/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	t.Run("test_valid", func(t *testing.T) {
+		got, err := parseEnvelope([]byte(`{"is_encrypted": true, "payload": "value", "data_version": 1}`), now)
+		assert.NoError(t, err)
+		assert.Equal(t, store.Envelope{IsEncrypted: true, DataVersion: 1}, got.Envelope)
+		assert.True(t, got.ExpiresAt.IsZero())
+	})
+
+	t.Run("test_not_json", func(t *testing.T) {
+		_, err := parseEnvelope([]byte(`value`), now)
+		assert.EqualError(t, err, "invalid payload envelope: it should be a json object")
+	})
+
+	t.Run("test_not_object", func(t *testing.T) {
+		_, err := parseEnvelope([]byte(`["value"]`), now)
+		assert.EqualError(t, err, "invalid payload envelope: it should be a json object")
+	})
+
+	t.Run("test_wrong_type", func(t *testing.T) {
+		_, err := parseEnvelope([]byte(`{"is_encrypted": "no", "payload": "value", "data_version": 1}`), now)
+		assert.EqualError(t, err, "invalid payload envelope: is_encrypted should be a bool")
+	})
+
+	t.Run("test_missing_fields", func(t *testing.T) {
+		_, err := parseEnvelope([]byte(`{"payload": "value", "data_version": 1}`), now)
+		assert.EqualError(t, err, "invalid payload envelope: is_encrypted is required")
+
+		_, err = parseEnvelope([]byte(`{"is_encrypted": false, "data_version": 1}`), now)
+		assert.EqualError(t, err, "invalid payload envelope: payload is required")
+
+		_, err = parseEnvelope([]byte(`{"is_encrypted": false, "payload": "value"}`), now)
+		assert.EqualError(t, err, "invalid payload envelope: data_version is required")
+	})
+
+	t.Run("test_unsupported_version", func(t *testing.T) {
+		_, err := parseEnvelope([]byte(`{"is_encrypted": false, "payload": "value", "data_version": 2}`), now)
+		assert.EqualError(t, err, "unsupported data_version 2, supported versions are [1]")
+	})
+
+	t.Run("test_ttl", func(t *testing.T) {
+		got, err := parseEnvelope([]byte(`{"is_encrypted": false, "payload": "value", "data_version": 1, "ttl": 60}`), now)
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(time.Minute), got.ExpiresAt)
+
+		_, err = parseEnvelope([]byte(`{"is_encrypted": false, "payload": "value", "data_version": 1, "ttl": 0}`), now)
+		assert.EqualError(t, err, "invalid payload envelope: ttl should be positive")
+	})
+
+	t.Run("test_expires_at", func(t *testing.T) {
+		got, err := parseEnvelope([]byte(`{"is_encrypted": false, "payload": "value", "data_version": 1, "expires_at": 1700000060}`), now)
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(time.Minute), got.ExpiresAt)
+
+		_, err = parseEnvelope([]byte(`{"is_encrypted": false, "payload": "value", "data_version": 1, "expires_at": 1700000000}`), now)
+		assert.EqualError(t, err, "invalid payload envelope: expires_at should be in the future")
+
+		_, err = parseEnvelope([]byte(`{"is_encrypted": false, "payload": "value", "data_version": 1, "ttl": 60, "expires_at": 1700000060}`), now)
+		assert.EqualError(t, err, "invalid payload envelope: ttl and expires_at can't be given together")
+	})
+}
@@ -0,0 +1,104 @@
+// Package app for pkid app
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rawdaGastan/pkid/pkg"
+	"github.com/rawdaGastan/pkid/store"
+)
+
+// formatETag formats the revision of a document as an ETag
+func formatETag(revision int64) string {
+	return strconv.Quote(strconv.FormatInt(revision, 10))
+}
+
+// parseETags parses the ETags of an If-Match or If-None-Match header into revisions, wildcard is true for `*`
+func parseETags(header string) (revisions []int64, wildcard bool, err error) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			wildcard = true
+			continue
+		}
+
+		tag = strings.TrimPrefix(tag, "W/")
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid ETag %s", tag)
+		}
+
+		revision, err := strconv.ParseInt(unquoted, 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid ETag %s", tag)
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, wildcard, nil
+}
+
+// hasRevision checks if the revision is one of the given revisions
+func hasRevision(revisions []int64, revision int64) bool {
+	for _, r := range revisions {
+		if r == revision {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedRevision resolves the If-Match and If-None-Match headers of a set request into the revision
+// the document should still have when it is written, revision 0 means the document should not exist.
+// conditional is false if the request has no preconditions
+func (a *App) expectedRevision(r *http.Request, key store.DocKey) (revision int64, conditional bool, res Response) {
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+
+	if ifMatch == "" && ifNoneMatch == "" {
+		return 0, false, nil
+	}
+
+	if ifMatch == "" && strings.TrimSpace(ifNoneMatch) == "*" {
+		return 0, true, nil
+	}
+
+	doc, err := a.db.Get(r.Context(), key)
+	if err != nil && !errors.Is(err, store.ErrNotExists) {
+		return 0, false, storeError(r.Context(), err, InternalServerError(errors.New("database get failed")))
+	}
+	current := doc.Revision
+
+	if ifMatch != "" {
+		revisions, wildcard, err := parseETags(ifMatch)
+		if err != nil {
+			return 0, false, BadRequest(err)
+		}
+
+		if current == 0 || (!wildcard && !hasRevision(revisions, current)) {
+			return 0, false, PreconditionFailed(errors.New("document revision doesn't match If-Match")).
+				WithCode(pkg.CodeVersionConflict).
+				WithDetails(map[string]interface{}{"current_version": current})
+		}
+	}
+
+	if ifNoneMatch != "" {
+		revisions, wildcard, err := parseETags(ifNoneMatch)
+		if err != nil {
+			return 0, false, BadRequest(err)
+		}
+
+		if (wildcard && current != 0) || hasRevision(revisions, current) {
+			return 0, false, PreconditionFailed(errors.New("document revision matches If-None-Match")).
+				WithCode(pkg.CodeVersionConflict).
+				WithDetails(map[string]interface{}{"current_version": current})
+		}
+	}
+
+	return current, true, nil
+}
@@ -2,14 +2,18 @@
 package app
 
 import (
-	"bytes"
+	"context"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/rawdaGastan/pkid/pkg"
+	"github.com/rawdaGastan/pkid/store"
 	"github.com/rs/zerolog/log"
 )
 
@@ -18,22 +22,209 @@ func (a *App) get(r *http.Request) (interface{}, Response) {
 	pk := mux.Vars(r)["pk"]
 	project := mux.Vars(r)["project"]
 	key := mux.Vars(r)["key"]
-	projectKey := project + "_" + key
 
-	docKey := pk + "_" + projectKey
-	value, err := a.db.Get(docKey)
+	docKey := store.DocKey{Pk: pk, Project: project, Key: key}
+
+	var doc store.Document
+	var err error
+	if r.URL.Query().Has("revision") {
+		revision, parseErr := strconv.ParseInt(r.URL.Query().Get("revision"), 10, 64)
+		if parseErr != nil {
+			return nil, BadRequest(errors.New("invalid revision"))
+		}
+		doc, err = a.db.GetRevision(r.Context(), docKey, revision)
+	} else {
+		doc, err = a.db.Get(r.Context(), docKey)
+	}
 	if err != nil {
-		log.Error().Err(err).Send()
-		return nil, NotFound(fmt.Errorf("can't find key: %s", docKey))
+		return nil, storeError(r.Context(), err, NotFound(fmt.Errorf("can't find key: %s", key)).WithCode(pkg.CodeNotFound))
+	}
+
+	res := Ok()
+	if notModified(r, doc) {
+		res = NotModified()
+	}
+
+	res = res.WithHeader("ETag", formatETag(doc.Revision))
+	if !doc.UpdatedAt.IsZero() {
+		res = res.WithHeader("Last-Modified", doc.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+
+	return documentMsg{
+		Message:   "data is got successfully",
+		Data:      doc.Value,
+		Size:      doc.Size,
+		CreatedAt: knownTime(doc.CreatedAt),
+		UpdatedAt: knownTime(doc.UpdatedAt),
+		ExpiresAt: knownTime(doc.ExpiresAt),
+	}, res
+}
+
+// revisionMsg is a kept revision of a document
+type revisionMsg struct {
+	Revision int64  `json:"revision"`
+	Data     string `json:"data"`
+}
+
+// history gets the kept revisions of the given key, the latest revision first
+func (a *App) history(r *http.Request) (interface{}, Response) {
+	pk := mux.Vars(r)["pk"]
+	project := mux.Vars(r)["project"]
+	key := mux.Vars(r)["key"]
+
+	docs, err := a.db.History(r.Context(), store.DocKey{Pk: pk, Project: project, Key: key})
+	if err != nil {
+		return nil, storeError(r.Context(), err, InternalServerError(errors.New("db history failed")))
+	}
+
+	if len(docs) == 0 {
+		return nil, NotFound(fmt.Errorf("can't find key: %s", key)).WithCode(pkg.CodeNotFound)
+	}
+
+	revisions := make([]revisionMsg, 0, len(docs))
+	for _, doc := range docs {
+		revisions = append(revisions, revisionMsg{Revision: doc.Revision, Data: doc.Value})
 	}
 
 	return ResponseMsg{
-		Message: "data is got successfully",
-		Data:    value,
+		Message: "history is got successfully",
+		Data:    revisions,
 	}, Ok()
 }
 
-// list all keys for a specific project, using the public key
+// restore sets the value of the given key back to one of its kept revisions, as a new revision that never expires
+func (a *App) restore(r *http.Request) (interface{}, Response) {
+	pk := mux.Vars(r)["pk"]
+	project := mux.Vars(r)["project"]
+	key := mux.Vars(r)["key"]
+
+	body, res := a.readBody(r)
+	if res != nil {
+		return nil, res
+	}
+
+	var restoreReq struct {
+		Revision int64 `json:"revision"`
+	}
+	if err := json.Unmarshal(body, &restoreReq); err != nil || restoreReq.Revision <= 0 {
+		return nil, BadRequest(errors.New(("a revision to restore is required")))
+	}
+
+	verifyPk, res := decodePublicKey(r.Context(), pk)
+	if res != nil {
+		return nil, res
+	}
+
+	res = a.authorize(r, verifyPk, signedRequest{
+		intent:  intentRestore,
+		project: project,
+		key:     key,
+		body:    body,
+	})
+	if res != nil {
+		return nil, res
+	}
+
+	docKey := store.DocKey{Pk: pk, Project: project, Key: key}
+	doc, err := a.db.GetRevision(r.Context(), docKey, restoreReq.Revision)
+	if err != nil {
+		return nil, storeError(r.Context(), err, NotFound(fmt.Errorf("can't find revision %d of key: %s", restoreReq.Revision, key)).WithCode(pkg.CodeNotFound))
+	}
+
+	if res := a.checkQuota(r.Context(), docKey, int64(len(doc.Value))); res != nil {
+		return nil, res
+	}
+
+	// the restored value keeps the expiry of the current document, it is not reset to the expiry of the revision
+	current, err := a.db.Get(r.Context(), docKey)
+	if err != nil && !errors.Is(err, store.ErrNotExists) {
+		return nil, storeError(r.Context(), err, InternalServerError(errors.New(("database get failed"))))
+	}
+
+	restored := store.Document{DocKey: docKey, Envelope: doc.Envelope, Value: doc.Value, Metadata: store.Metadata{ExpiresAt: current.ExpiresAt}}
+	revision, err := a.db.Set(r.Context(), restored)
+	if err != nil {
+		return nil, storeError(r.Context(), err, InternalServerError(errors.New(("database set failed"))))
+	}
+
+	return ResponseMsg{
+		Message: fmt.Sprintf("revision %d is restored successfully", restoreReq.Revision),
+		Data:    nil,
+	}, Created().WithHeader("ETag", formatETag(revision))
+}
+
+// projectUsageMsg is the storage used by a project
+type projectUsageMsg struct {
+	Project string `json:"project"`
+	Keys    int    `json:"keys"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// usageMsg is the storage used by a public key with its quotas, 0 quotas are not limited
+type usageMsg struct {
+	Projects          int               `json:"projects"`
+	Keys              int               `json:"keys"`
+	Bytes             int64             `json:"bytes"`
+	PerProject        []projectUsageMsg `json:"per_project"`
+	MaxProjects       int               `json:"max_projects"`
+	MaxKeysPerProject int               `json:"max_keys_per_project"`
+	MaxBytes          int64             `json:"max_bytes"`
+	MaxBodySize       int64             `json:"max_body_size"`
+}
+
+// projectUsageMsgs gets the messages of the storage used by projects
+func projectUsageMsgs(usage []store.ProjectUsage) []projectUsageMsg {
+	projects := make([]projectUsageMsg, 0, len(usage))
+	for _, project := range usage {
+		projects = append(projects, projectUsageMsg{Project: project.Project, Keys: project.Keys, Bytes: project.Bytes})
+	}
+	return projects
+}
+
+// usage gets the storage used by the public key and its quotas
+func (a *App) usage(r *http.Request) (interface{}, Response) {
+	pk := mux.Vars(r)["pk"]
+
+	usage, err := a.db.Usage(r.Context(), pk)
+	if err != nil {
+		return nil, storeError(r.Context(), err, InternalServerError(errors.New("db usage failed")))
+	}
+
+	msg := usageMsg{
+		Projects:          len(usage),
+		PerProject:        projectUsageMsgs(usage),
+		MaxProjects:       a.config.MaxProjectsPerPk,
+		MaxKeysPerProject: a.config.MaxKeysPerProject,
+		MaxBytes:          a.config.MaxBytesPerPk,
+		MaxBodySize:       a.config.MaxBodySize,
+	}
+	for _, project := range usage {
+		msg.Keys += project.Keys
+		msg.Bytes += project.Bytes
+	}
+
+	return ResponseMsg{
+		Message: "usage is got successfully",
+		Data:    msg,
+	}, Ok()
+}
+
+// projects lists the projects of the public key ordered by name, with the number of keys and bytes of each one
+func (a *App) projects(r *http.Request) (interface{}, Response) {
+	pk := mux.Vars(r)["pk"]
+
+	usage, err := a.db.Usage(r.Context(), pk)
+	if err != nil {
+		return nil, storeError(r.Context(), err, InternalServerError(errors.New("db list projects failed")))
+	}
+
+	return ResponseMsg{
+		Message: "projects are listed successfully",
+		Data:    projectUsageMsgs(usage),
+	}, Ok()
+}
+
+// list a page of the keys of a specific project ordered by key, using the public key
 func (a *App) list(r *http.Request) (interface{}, Response) {
 
 	pk := mux.Vars(r)["pk"]
@@ -43,26 +234,41 @@ func (a *App) list(r *http.Request) (interface{}, Response) {
 		return nil, BadRequest(errors.New("db list project failed with error: no project given"))
 	}
 
-	AllKeys, err := a.db.List()
+	opts, res := listOptions(r.URL.Query())
+	if res != nil {
+		return nil, res
+	}
+
+	withMetadata, res := listMetadata(r.URL.Query())
+	if res != nil {
+		return nil, res
+	}
+
+	// one more key is listed to know if there is a next page
+	limit := opts.Limit
+	opts.Limit++
+
+	metadata, err := a.db.ListMetadata(r.Context(), pk, project, opts)
 	if err != nil {
-		log.Error().Err(err).Send()
-		return nil, InternalServerError(errors.New("db list failed"))
+		return nil, storeError(r.Context(), err, InternalServerError(errors.New("db list failed")))
 	}
 
-	keys := []string{}
-	for _, key := range AllKeys {
-		if strings.HasPrefix(key, pk+"_"+project+"_") {
-			splitKey := strings.Split(key, "_")
-			if len(splitKey) == 3 {
-				keys = append(keys, splitKey[2])
-			}
-		}
+	msg := pageMsg{Message: "data is listed successfully"}
+	if len(metadata) > limit {
+		metadata = metadata[:limit]
+		msg.NextCursor = encodeCursor(metadata[limit-1].Key)
 	}
 
-	return ResponseMsg{
-		Message: "data is listed successfully",
-		Data:    keys,
-	}, Ok()
+	msg.Data = make([]string, 0, len(metadata))
+	for _, m := range metadata {
+		msg.Data = append(msg.Data, m.Key)
+	}
+
+	if withMetadata {
+		msg.Metadata = keyMetadataMsgs(metadata)
+	}
+
+	return msg, Ok()
 }
 
 func (a *App) deleteProject(r *http.Request) (interface{}, Response) {
@@ -73,20 +279,22 @@ func (a *App) deleteProject(r *http.Request) (interface{}, Response) {
 		return nil, BadRequest(errors.New("db list project failed with error: no project given"))
 	}
 
-	AllKeys, err := a.db.List()
-	if err != nil {
-		log.Error().Err(err).Send()
-		return nil, InternalServerError(errors.New("db list failed"))
+	verifyPk, res := decodePublicKey(r.Context(), pk)
+	if res != nil {
+		return nil, res
 	}
 
-	for _, key := range AllKeys {
-		if strings.HasPrefix(key, pk+"_"+project+"_") {
-			err := a.db.Delete(key)
-			if err != nil {
-				log.Error().Err(err).Send()
-				return nil, InternalServerError(fmt.Errorf("db deleting key %s failed", key))
-			}
-		}
+	res = a.authorize(r, verifyPk, signedRequest{
+		intent:  intentDeleteProject,
+		project: project,
+	})
+	if res != nil {
+		return nil, res
+	}
+
+	err := a.db.DeleteProject(r.Context(), pk, project)
+	if err != nil {
+		return nil, storeError(r.Context(), err, InternalServerError(fmt.Errorf("db deleting project %s failed", project)))
 	}
 
 	return ResponseMsg{
@@ -100,13 +308,27 @@ func (a *App) delete(r *http.Request) (interface{}, Response) {
 	pk := mux.Vars(r)["pk"]
 	project := mux.Vars(r)["project"]
 	key := mux.Vars(r)["key"]
-	projectKey := project + "_" + key
 
-	docKey := pk + "_" + projectKey
-	err := a.db.Delete(docKey)
+	verifyPk, res := decodePublicKey(r.Context(), pk)
+	if res != nil {
+		return nil, res
+	}
+
+	res = a.authorize(r, verifyPk, signedRequest{
+		intent:  intentDelete,
+		project: project,
+		key:     key,
+	})
+	if res != nil {
+		return nil, res
+	}
+
+	err := a.db.Delete(r.Context(), store.DocKey{Pk: pk, Project: project, Key: key})
+	if errors.Is(err, store.ErrDeleteFailed) {
+		return nil, NotFound(fmt.Errorf("can't find key: %s", key)).WithCode(pkg.CodeNotFound)
+	}
 	if err != nil {
-		log.Error().Err(err).Send()
-		return nil, InternalServerError(errors.New(("db deletion failed")))
+		return nil, storeError(r.Context(), err, InternalServerError(errors.New(("db deletion failed"))))
 	}
 
 	return ResponseMsg{
@@ -120,63 +342,212 @@ func (a *App) set(r *http.Request) (interface{}, Response) {
 	pk := mux.Vars(r)["pk"]
 	project := mux.Vars(r)["project"]
 	key := mux.Vars(r)["key"]
-	projectKey := project + "_" + key
 
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(r.Body)
-	if err != nil {
-		log.Error().Err(err).Send()
-		return nil, BadRequest(errors.New(("failed to read body")))
+	if res := validateNames(project, key); res != nil {
+		return nil, res
+	}
+
+	buf, res := a.readBody(r)
+	if res != nil {
+		return nil, res
 	}
 
-	body := buf.String()
+	body := string(buf)
 
 	if body == "" {
-		log.Error().Err(err).Send()
 		return nil, BadRequest(errors.New(("no body is provided")))
 	}
 
 	// verify key
-	if len(pk) == 0 {
-		log.Error().Err(err).Send()
-		return nil, BadRequest(errors.New(("public key is empty")))
-	}
-
-	verifyPk, err := hex.DecodeString(pk)
-	if err != nil {
-		log.Error().Err(err).Send()
-		return nil, BadRequest(errors.New(("cannot verify public key")))
+	verifyPk, res := decodePublicKey(r.Context(), pk)
+	if res != nil {
+		return nil, res
 	}
 
 	if r.Header.Get("Authorization") == "" {
-		log.Error().Err(err).Send()
-		return nil, UnAuthorized(errors.New(("no Authorization is provided")))
+		a.metrics.SignatureFailure(reasonMissingHeader)
+		return nil, UnAuthorized(errors.New(("no Authorization is provided"))).WithCode(pkg.CodeAuthorizationMissing)
 	}
 
 	// verify
-	verified, err := verifySignedData(body, verifyPk)
-	if !verified || err != nil {
-		log.Error().Err(err).Send()
-		return nil, BadRequest(errors.New(("invalid data")))
+	doc, res := a.openDocument(r.Context(), body, verifyPk)
+	if res != nil {
+		return nil, res
+	}
+
+	res = a.authorize(r, verifyPk, signedRequest{
+		intent:  intentStore,
+		project: project,
+		key:     key,
+		body:    buf,
+	})
+	if res != nil {
+		return nil, res
+	}
+
+	docKey := store.DocKey{Pk: pk, Project: project, Key: key}
+	if res := a.checkQuota(r.Context(), docKey, int64(len(body))); res != nil {
+		return nil, res
 	}
 
-	authHeader, err := verifySignedHeader(r.Header.Get("Authorization"), verifyPk)
-	if !authHeader || err != nil {
-		log.Error().Err(err).Send()
-		return nil, UnAuthorized(errors.New(("invalid authorization header")))
+	expected, conditional, res := a.expectedRevision(r, docKey)
+	if res != nil {
+		return nil, res
 	}
 
 	// set date
-	docKey := pk + "_" + projectKey
-	err = a.db.Set(docKey, body)
+	doc.DocKey = docKey
+	doc.Value = body
+	var revision int64
+	var err error
+	if conditional {
+		revision, err = a.db.SetIf(r.Context(), doc, expected)
+	} else {
+		revision, err = a.db.Set(r.Context(), doc)
+	}
+	if errors.Is(err, store.ErrRevisionMismatch) {
+		return nil, PreconditionFailed(errors.New("document is modified by another request")).WithCode(pkg.CodeVersionConflict)
+	}
 	if err != nil {
-		log.Error().Err(err).Send()
-		return nil, InternalServerError(errors.New(("database set failed")))
+		return nil, storeError(r.Context(), err, InternalServerError(errors.New(("database set failed"))))
 	}
 
 	// response
 	return ResponseMsg{
 		Message: "data is set successfully",
 		Data:    nil,
-	}, Created()
+	}, Created().WithHeader("ETag", formatETag(revision))
+}
+
+// openDocument verifies the signed payload envelope of a value and gets the document of its metadata and expiry,
+// the key and value of the document are set by the caller
+func (a *App) openDocument(ctx context.Context, value string, pk []byte) (store.Document, Response) {
+	payload, err := verifySignedData(value, pk)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Send()
+		a.metrics.SignatureFailure(reasonPayloadSignature)
+		return store.Document{}, BadRequest(errors.New(("invalid data"))).WithCode(pkg.CodeSignatureInvalid)
+	}
+
+	doc, err := parseEnvelope(payload, a.now())
+	if errors.Is(err, errUnsupportedDataVersion) {
+		return store.Document{}, BadRequest(err).WithCode(pkg.CodeDataVersionUnsupported).WithDetails(map[string]interface{}{
+			"supported_versions": supportedDataVersions,
+		})
+	}
+	if err != nil {
+		return store.Document{}, BadRequest(err).WithCode(pkg.CodePayloadInvalid)
+	}
+
+	return doc, nil
+}
+
+// storeError logs the error of a store operation and gets its response, operations that are stopped
+// by the request context get 504 if the database timed out or 503 if the request is canceled
+func storeError(ctx context.Context, err error, res Response) Response {
+	log.Ctx(ctx).Error().Err(err).Send()
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return GatewayTimeout(errors.New("database timeout")).WithCode(pkg.CodeDatabaseTimeout)
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+		return ServiceUnavailable(errors.New("request is canceled")).WithCode(pkg.CodeRequestCanceled)
+	}
+
+	return res
+}
+
+// decode the hex encoded public key of the request
+func decodePublicKey(ctx context.Context, pk string) ([]byte, Response) {
+	if len(pk) == 0 {
+		return nil, BadRequest(errors.New(("public key is empty"))).WithCode(pkg.CodeInvalidPublicKey)
+	}
+
+	verifyPk, err := hex.DecodeString(pk)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Send()
+		return nil, BadRequest(errors.New(("cannot verify public key"))).WithCode(pkg.CodeInvalidPublicKey)
+	}
+
+	return verifyPk, nil
+}
+
+// authorize verifies the signed Authorization header of the request against what it should be bound to
+// and rejects headers that are already used
+func (a *App) authorize(r *http.Request, pk []byte, req signedRequest) Response {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		a.metrics.SignatureFailure(reasonMissingHeader)
+		return UnAuthorized(errors.New(("no Authorization is provided"))).WithCode(pkg.CodeAuthorizationMissing)
+	}
+
+	skew := time.Duration(a.config.ClockSkew) * time.Second
+	header, err := verifySignedHeader(authorization, pk, skew)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Send()
+		a.metrics.SignatureFailure(headerFailureReason(err))
+		return headerError(err, skew)
+	}
+
+	version, _ := header["version"].(float64)
+	if int(version) != headerVersion {
+		if a.config.DisableLegacyHeaders || !legacyIntents[req.intent] {
+			a.metrics.SignatureFailure(reasonHeaderVersion)
+			return UnAuthorized(fmt.Errorf("unsupported authorization header version, version %d is required", headerVersion)).
+				WithCode(pkg.CodeHeaderVersionUnsupported).
+				WithDetails(map[string]interface{}{"required_version": headerVersion})
+		}
+		log.Ctx(r.Context()).Warn().Str("intent", req.intent).Msg("deprecated authorization header without version is used")
+	}
+
+	req.method = r.Method
+	if err := verifyHeaderClaims(header, req.claims(int(version))); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Send()
+		a.metrics.SignatureFailure(reasonHeaderClaims)
+		return UnAuthorized(errors.New(("invalid authorization header"))).WithCode(pkg.CodeHeaderInvalid)
+	}
+
+	nonce, _ := header["nonce"].(string)
+	if nonce == "" && int(version) != headerVersion {
+		// legacy clients sign the same header for two requests of the same intent in the same second,
+		// so their headers without a nonce are only bounded by the clock skew
+		return nil
+	}
+
+	// versioned headers without a nonce can only be used once as they are
+	if nonce == "" {
+		nonce = authorization
+	}
+
+	timestamp := time.Unix(int64(header["timestamp"].(float64)), 0)
+	err = a.nonces.use(hex.EncodeToString(pk)+":"+nonce, timestamp.Add(skew), time.Now())
+	if errors.Is(err, errNonceCacheFull) {
+		log.Ctx(r.Context()).Error().Err(err).Send()
+		retryAfter := int64(skew.Seconds())
+		return TooManyRequests(errors.New("too many signed requests, try again later")).
+			WithCode(pkg.CodeRateLimited).
+			WithDetails(map[string]interface{}{"retry_after": retryAfter}).
+			WithHeader("Retry-After", strconv.FormatInt(retryAfter, 10))
+	}
+	if err != nil {
+		a.metrics.SignatureFailure(reasonReplayedNonce)
+		return UnAuthorized(errors.New(("authorization header is already used"))).WithCode(pkg.CodeHeaderReplayed)
+	}
+
+	return nil
+}
+
+// headerError gets the response of a signed header that failed verification
+func headerError(err error, skew time.Duration) Response {
+	switch {
+	case errors.Is(err, errClockSkew):
+		return UnAuthorized(errors.New("authorization header is expired")).
+			WithCode(pkg.CodeHeaderExpired).
+			WithDetails(map[string]interface{}{"clock_skew": int64(skew.Seconds())})
+	case errors.Is(err, errHeaderSignature):
+		return UnAuthorized(errors.New("invalid authorization header signature")).WithCode(pkg.CodeSignatureInvalid)
+	default:
+		return UnAuthorized(errors.New(("invalid authorization header"))).WithCode(pkg.CodeHeaderInvalid)
+	}
 }
@@ -4,7 +4,9 @@ package app
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -15,29 +17,77 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/rawdaGastan/pkid/client"
+	"github.com/rawdaGastan/pkid/config"
+	"github.com/rawdaGastan/pkid/middlewares"
 	"github.com/rawdaGastan/pkid/pkg"
 	"github.com/stretchr/testify/assert"
 )
 
 func setUp(t testing.TB) *App {
+	return setUpWithConfig(t, `{
+		"port": ":3000",
+		"version": "v1",
+		"db_driver": "memory"
+	}`)
+}
+
+// setUpWithConfig creates an app with the given json configurations
+func setUpWithConfig(t testing.TB, jsonConfig string) *App {
 	dir := t.TempDir()
 
 	configPath := filepath.Join(dir, "config.json")
-	config := `{
-		"port": ":3000",
-		"version": "v1",
-		"db_file": "pkid.db"
-	}`
 
-	err := os.WriteFile(configPath, []byte(config), 0644)
+	err := os.WriteFile(configPath, []byte(jsonConfig), 0644)
+	assert.NoError(t, err)
+
+	conf, err := config.ReadConfFile(configPath)
 	assert.NoError(t, err)
 
-	app, err := NewApp(context.Background(), configPath)
+	app, err := NewApp(context.Background(), conf)
 	assert.NoError(t, err)
 
 	return app
 }
 
+// nonce generates a unique nonce for signed headers
+func nonce() string {
+	return fmt.Sprint(time.Now().UnixNano())
+}
+
+// signedPayload signs a plain payload of the given value
+func signedPayload(t testing.TB, privateKey []byte, value string) string {
+	payload := map[string]interface{}{
+		"is_encrypted": false,
+		"payload":      value,
+		"data_version": 1,
+	}
+
+	signedBody, err := pkg.SignEncode(payload, privateKey)
+	assert.NoError(t, err)
+
+	return signedBody
+}
+
+// signHeader signs a version 2 header that is bound to the given request
+func signHeader(t testing.TB, privateKey []byte, method, intent, project, key string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	header := map[string]interface{}{
+		"version":   headerVersion,
+		"intent":    intent,
+		"nonce":     nonce(),
+		"timestamp": time.Now().Unix(),
+		"method":    method,
+		"project":   project,
+		"key":       key,
+		"body_hash": hex.EncodeToString(bodyHash[:]),
+	}
+
+	signedHeader, err := pkg.SignEncode(header, privateKey)
+	assert.NoError(t, err)
+
+	return signedHeader
+}
+
 func TestHandlers(t *testing.T) {
 	app := setUp(t)
 
@@ -47,6 +97,7 @@ func TestHandlers(t *testing.T) {
 	t.Run("test set", func(t *testing.T) {
 		header := map[string]interface{}{
 			"intent":    "pkid.store",
+			"nonce":     nonce(),
 			"timestamp": time.Now().Unix(),
 		}
 
@@ -83,9 +134,247 @@ func TestHandlers(t *testing.T) {
 		assert.Equal(t, response.Code, http.StatusCreated)
 	})
 
+	t.Run("test set underscore names", func(t *testing.T) {
+		// only the route segments like _batch are reserved
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, setRequest(t, privateKey, publicKey, "_pkid", "_key", "value"))
+		assert.Equal(t, response.Code, http.StatusCreated)
+	})
+
+	t.Run("test set bound header", func(t *testing.T) {
+		signedBody := signedPayload(t, privateKey, "value")
+		signedHeader := signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", "key", []byte(signedBody))
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusCreated)
+	})
+
+	t.Run("test set unsupported data version", func(t *testing.T) {
+		signedBody, err := pkg.SignEncode(map[string]interface{}{
+			"is_encrypted": false,
+			"payload":      "value",
+			"data_version": 2,
+		}, privateKey)
+		assert.NoError(t, err)
+		signedHeader := signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", "key", []byte(signedBody))
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+		assert.Contains(t, response.Body.String(), "unsupported data_version 2")
+
+		var body ErrorMsg
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		assert.Equal(t, pkg.CodeDataVersionUnsupported, body.Code)
+		assert.Equal(t, []interface{}{float64(1)}, body.Details["supported_versions"])
+	})
+
+	t.Run("test set header bound to other key", func(t *testing.T) {
+		signedBody := signedPayload(t, privateKey, "value")
+		signedHeader := signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", "other", []byte(signedBody))
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("test set header bound to other body", func(t *testing.T) {
+		signedBody := signedPayload(t, privateKey, "value")
+		signedHeader := signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", "key", []byte(signedPayload(t, privateKey, "other")))
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("test set header bound to other method", func(t *testing.T) {
+		signedBody := signedPayload(t, privateKey, "value")
+		signedHeader := signHeader(t, privateKey, http.MethodDelete, intentStore, "pkid", "key", []byte(signedBody))
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("test set legacy header disabled", func(t *testing.T) {
+		app.config.DisableLegacyHeaders = true
+		defer func() { app.config.DisableLegacyHeaders = false }()
+
+		header := map[string]interface{}{
+			"intent":    "pkid.store",
+			"nonce":     nonce(),
+			"timestamp": time.Now().Unix(),
+		}
+
+		signedHeader, err := pkg.SignEncode(header, privateKey)
+		assert.NoError(t, err)
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedPayload(t, privateKey, "value"))))
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("test set replayed auth", func(t *testing.T) {
+		header := map[string]interface{}{
+			"intent":    "pkid.store",
+			"nonce":     nonce(),
+			"timestamp": time.Now().Unix(),
+		}
+
+		payload := map[string]interface{}{
+			"is_encrypted": false,
+			"payload":      "value",
+			"data_version": 1,
+		}
+
+		signedBody, err := pkg.SignEncode(payload, privateKey)
+		assert.NoError(t, err)
+
+		signedHeader, err := pkg.SignEncode(header, privateKey)
+		assert.NoError(t, err)
+
+		codes := []int{}
+		for i := 0; i < 2; i++ {
+			requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+			req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+
+			req.Header.Set("Authorization", signedHeader)
+			req.Header.Set("Content-Type", "application/json")
+
+			req = mux.SetURLVars(req, map[string]string{
+				"pk":      hex.EncodeToString(publicKey),
+				"project": "pkid",
+				"key":     "key",
+			})
+
+			response := httptest.NewRecorder()
+			WrapFunc(app.set).ServeHTTP(response, req)
+			codes = append(codes, response.Code)
+		}
+
+		assert.Equal(t, codes, []int{http.StatusCreated, http.StatusUnauthorized})
+	})
+
+	t.Run("test set legacy header without nonce twice", func(t *testing.T) {
+		// an old client signs the same header for two writes in the same second
+		signedHeader, err := pkg.SignEncode(map[string]interface{}{
+			"intent":    "pkid.store",
+			"timestamp": time.Now().Unix(),
+		}, privateKey)
+		assert.NoError(t, err)
+
+		for _, value := range []string{"value1", "value2"} {
+			requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+			req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedPayload(t, privateKey, value))))
+			req.Header.Set("Authorization", signedHeader)
+			req = mux.SetURLVars(req, map[string]string{
+				"pk":      hex.EncodeToString(publicKey),
+				"project": "pkid",
+				"key":     "key",
+			})
+
+			response := httptest.NewRecorder()
+			WrapFunc(app.set).ServeHTTP(response, req)
+			assert.Equal(t, http.StatusCreated, response.Code)
+		}
+	})
+
+	t.Run("test set future auth", func(t *testing.T) {
+		header := map[string]interface{}{
+			"intent":    "pkid.store",
+			"nonce":     nonce(),
+			"timestamp": time.Now().Unix() + 10,
+		}
+
+		payload := map[string]interface{}{
+			"is_encrypted": false,
+			"payload":      "value",
+			"data_version": 1,
+		}
+
+		signedBody, err := pkg.SignEncode(payload, privateKey)
+		assert.NoError(t, err)
+
+		signedHeader, err := pkg.SignEncode(header, privateKey)
+		assert.NoError(t, err)
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+
+		req.Header.Set("Authorization", signedHeader)
+		req.Header.Set("Content-Type", "application/json")
+
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+		assert.Equal(t, pkg.CodeHeaderExpired, errorCode(t, response))
+	})
+
 	t.Run("test set failed auth", func(t *testing.T) {
 		header := map[string]interface{}{
 			"intent":    "pkid.store",
+			"nonce":     nonce(),
 			"timestamp": time.Now().Unix() - 10,
 		}
 
@@ -125,6 +414,7 @@ func TestHandlers(t *testing.T) {
 	t.Run("test set no body", func(t *testing.T) {
 		header := map[string]interface{}{
 			"intent":    "pkid.store",
+			"nonce":     nonce(),
 			"timestamp": time.Now().Unix(),
 		}
 
@@ -222,6 +512,249 @@ func TestHandlers(t *testing.T) {
 		assert.Equal(t, response.Code, http.StatusOK)
 	})
 
+	t.Run("test get canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodGet, requestURL, nil).WithContext(ctx)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.get).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusServiceUnavailable)
+	})
+
+	t.Run("test get timeout", func(t *testing.T) {
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodGet, requestURL, nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		middlewares.Timeout(0)(WrapFunc(app.get)).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusGatewayTimeout)
+	})
+
+	t.Run("test get etag", func(t *testing.T) {
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodGet, requestURL, nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.get).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		etag := response.Header().Get("ETag")
+		assert.NotEmpty(t, etag)
+
+		// set with the current etag
+		signedBody := signedPayload(t, privateKey, "value")
+		req = httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+		req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", "key", []byte(signedBody)))
+		req.Header.Set("If-Match", etag)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response = httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusCreated)
+		assert.NotEqual(t, response.Header().Get("ETag"), etag)
+
+		// set with the stale etag
+		req = httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+		req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", "key", []byte(signedBody)))
+		req.Header.Set("If-Match", etag)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response = httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusPreconditionFailed)
+	})
+
+	t.Run("test set if none match", func(t *testing.T) {
+		signedBody := signedPayload(t, privateKey, "value")
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+		req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", "key", []byte(signedBody)))
+		req.Header.Set("If-None-Match", "*")
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusPreconditionFailed)
+	})
+
+	t.Run("test set invalid etag", func(t *testing.T) {
+		signedBody := signedPayload(t, privateKey, "value")
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+		req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", "key", []byte(signedBody)))
+		req.Header.Set("If-Match", "revision")
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("test history", func(t *testing.T) {
+		requestURL := fmt.Sprintf("/%v/%v/%v/history", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodGet, requestURL, nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.history).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("test get revision", func(t *testing.T) {
+		requestURL := fmt.Sprintf("/%v/%v/%v?revision=1", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodGet, requestURL, nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.get).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, response.Header().Get("ETag"), `"1"`)
+	})
+
+	t.Run("test get invalid revision", func(t *testing.T) {
+		requestURL := fmt.Sprintf("/%v/%v/%v?revision=first", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodGet, requestURL, nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.get).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("test restore", func(t *testing.T) {
+		body := []byte(`{"revision": 1}`)
+
+		requestURL := fmt.Sprintf("/%v/%v/%v/restore", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader(body))
+		req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentRestore, "pkid", "key", body))
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.restore).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusCreated)
+	})
+
+	t.Run("test restore legacy header", func(t *testing.T) {
+		body := []byte(`{"revision": 1}`)
+		header := map[string]interface{}{
+			"intent":    intentRestore,
+			"nonce":     nonce(),
+			"timestamp": time.Now().Unix(),
+		}
+
+		signedHeader, err := pkg.SignEncode(header, privateKey)
+		assert.NoError(t, err)
+
+		requestURL := fmt.Sprintf("/%v/%v/%v/restore", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader(body))
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.restore).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("test delete legacy header", func(t *testing.T) {
+		header := map[string]interface{}{
+			"intent":    intentDelete,
+			"nonce":     nonce(),
+			"project":   "pkid",
+			"key":       "key",
+			"timestamp": time.Now().Unix(),
+		}
+
+		signedHeader, err := pkg.SignEncode(header, privateKey)
+		assert.NoError(t, err)
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodDelete, requestURL, nil)
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.delete).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+		assert.Equal(t, pkg.CodeHeaderVersionUnsupported, errorCode(t, response))
+	})
+
+	t.Run("test restore missing revision", func(t *testing.T) {
+		body := []byte(`{"revision": 100}`)
+
+		requestURL := fmt.Sprintf("/%v/%v/%v/restore", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader(body))
+		req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentRestore, "pkid", "key", body))
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.restore).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusNotFound)
+	})
+
 	t.Run("test get empty", func(t *testing.T) {
 		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "")
 		req := httptest.NewRequest(http.MethodGet, requestURL, nil)
@@ -234,6 +767,7 @@ func TestHandlers(t *testing.T) {
 		response := httptest.NewRecorder()
 		WrapFunc(app.get).ServeHTTP(response, req)
 		assert.Equal(t, response.Code, http.StatusNotFound)
+		assert.Equal(t, pkg.CodeNotFound, errorCode(t, response))
 	})
 
 	t.Run("test get empty server", func(t *testing.T) {
@@ -276,9 +810,67 @@ func TestHandlers(t *testing.T) {
 		assert.Equal(t, response.Code, http.StatusBadRequest)
 	})
 
+	t.Run("test delete no auth", func(t *testing.T) {
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodDelete, requestURL, nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.delete).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("test delete wrong key auth", func(t *testing.T) {
+		signedHeader := signHeader(t, privateKey, http.MethodDelete, intentDelete, "pkid", "other", nil)
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodDelete, requestURL, nil)
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.delete).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("test delete store intent", func(t *testing.T) {
+		header := map[string]interface{}{
+			"intent":    "pkid.store",
+			"nonce":     nonce(),
+			"timestamp": time.Now().Unix(),
+		}
+
+		signedHeader, err := pkg.SignEncode(header, privateKey)
+		assert.NoError(t, err)
+
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodDelete, requestURL, nil)
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.delete).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
 	t.Run("test delete", func(t *testing.T) {
+		signedHeader := signHeader(t, privateKey, http.MethodDelete, intentDelete, "pkid", "key", nil)
+
 		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
 		req := httptest.NewRequest(http.MethodDelete, requestURL, nil)
+		req.Header.Set("Authorization", signedHeader)
 		req = mux.SetURLVars(req, map[string]string{
 			"pk":      hex.EncodeToString(publicKey),
 			"project": "pkid",
@@ -291,8 +883,11 @@ func TestHandlers(t *testing.T) {
 	})
 
 	t.Run("test delete empty", func(t *testing.T) {
+		signedHeader := signHeader(t, privateKey, http.MethodDelete, intentDeleteProject, "pkid", "", nil)
+
 		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "")
 		req := httptest.NewRequest(http.MethodDelete, requestURL, nil)
+		req.Header.Set("Authorization", signedHeader)
 		req = mux.SetURLVars(req, map[string]string{
 			"pk":      hex.EncodeToString(publicKey),
 			"project": "pkid",
@@ -304,9 +899,41 @@ func TestHandlers(t *testing.T) {
 		assert.Equal(t, response.Code, http.StatusNoContent)
 	})
 
+	t.Run("test delete project no auth", func(t *testing.T) {
+		requestURL := fmt.Sprintf("/%v/%v", hex.EncodeToString(publicKey), "pkid")
+		req := httptest.NewRequest(http.MethodDelete, requestURL, nil)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.deleteProject).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("test delete project wrong project auth", func(t *testing.T) {
+		signedHeader := signHeader(t, privateKey, http.MethodDelete, intentDeleteProject, "other", "", nil)
+
+		requestURL := fmt.Sprintf("/%v/%v", hex.EncodeToString(publicKey), "pkid")
+		req := httptest.NewRequest(http.MethodDelete, requestURL, nil)
+		req.Header.Set("Authorization", signedHeader)
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.deleteProject).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
 	t.Run("test delete project", func(t *testing.T) {
+		signedHeader := signHeader(t, privateKey, http.MethodDelete, intentDeleteProject, "pkid", "", nil)
+
 		requestURL := fmt.Sprintf("/%v/%v", hex.EncodeToString(publicKey), "pkid")
 		req := httptest.NewRequest(http.MethodDelete, requestURL, nil)
+		req.Header.Set("Authorization", signedHeader)
 		req = mux.SetURLVars(req, map[string]string{
 			"pk":      hex.EncodeToString(publicKey),
 			"project": "pkid",
@@ -330,3 +957,74 @@ func TestHandlers(t *testing.T) {
 		assert.Equal(t, response.Code, http.StatusBadRequest)
 	})
 }
+
+func TestRequestID(t *testing.T) {
+	app := setUp(t)
+	router := app.router()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/pk/pkid/missing", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "my-request")
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, req)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, "my-request", response.Header().Get(middlewares.RequestIDHeader))
+
+	var body struct {
+		Err       string `json:"err"`
+		RequestID string `json:"request_id"`
+	}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.NotEmpty(t, body.Err)
+	assert.Equal(t, "my-request", body.RequestID)
+
+	t.Run("test unmatched routes", func(t *testing.T) {
+		for req, status := range map[*http.Request]int{
+			httptest.NewRequest(http.MethodGet, "/missing", nil): http.StatusNotFound,
+			httptest.NewRequest(http.MethodPut, "/healthz", nil): http.StatusMethodNotAllowed,
+		} {
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, req)
+			assert.Equal(t, status, response.Code)
+			assert.NotEmpty(t, response.Header().Get(middlewares.RequestIDHeader))
+		}
+	})
+}
+
+func TestProjects(t *testing.T) {
+	app := setUp(t)
+	router := app.router()
+
+	privateKey, publicKey, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	listProjects := func() []projectUsageMsg {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/v1/"+hex.EncodeToString(publicKey), nil))
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var body struct {
+			Data []projectUsageMsg `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		return body.Data
+	}
+
+	t.Run("test no projects", func(t *testing.T) {
+		assert.Equal(t, []projectUsageMsg{}, listProjects())
+	})
+
+	t.Run("test projects", func(t *testing.T) {
+		for _, doc := range [][2]string{{"b", "key"}, {"a", "key"}, {"a", "other"}} {
+			response := httptest.NewRecorder()
+			WrapFunc(app.set).ServeHTTP(response, setRequest(t, privateKey, publicKey, doc[0], doc[1], "value"))
+			assert.Equal(t, http.StatusCreated, response.Code)
+		}
+
+		valueSize := int64(len(signedPayload(t, privateKey, "value")))
+		assert.Equal(t, []projectUsageMsg{
+			{Project: "a", Keys: 2, Bytes: 2 * valueSize},
+			{Project: "b", Keys: 1, Bytes: valueSize},
+		}, listProjects())
+	})
+}
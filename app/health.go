@@ -0,0 +1,51 @@
+// Package app for pkid app
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rawdaGastan/pkid/pkg"
+	"github.com/rs/zerolog/log"
+)
+
+// healthz reports that the server is alive, it doesn't check the database
+func (a *App) healthz(r *http.Request) (interface{}, Response) {
+	return ResponseMsg{
+		Message: "pkid is alive",
+		Data:    nil,
+	}, Ok()
+}
+
+// readyz reports that the server can serve requests, the database should be reachable and migrated
+// and the server should not be shutting down
+func (a *App) readyz(r *http.Request) (interface{}, Response) {
+	if a.draining.Load() {
+		return nil, ServiceUnavailable(errors.New("server is shutting down")).WithCode(pkg.CodeNotReady)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(a.config.DBTimeout)*time.Second)
+	defer cancel()
+
+	if err := a.db.Ping(ctx); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("database is not reachable")
+		return nil, ServiceUnavailable(errors.New("database is not reachable")).WithCode(pkg.CodeNotReady)
+	}
+
+	migrated, err := a.db.Migrated(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to check database migrations")
+		return nil, ServiceUnavailable(errors.New("database is not reachable")).WithCode(pkg.CodeNotReady)
+	}
+
+	if !migrated {
+		return nil, ServiceUnavailable(errors.New("database is not migrated")).WithCode(pkg.CodeNotReady)
+	}
+
+	return ResponseMsg{
+		Message: "pkid is ready",
+		Data:    nil,
+	}, Ok()
+}
@@ -0,0 +1,59 @@
+// Package app for pkid app
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/rawdaGastan/pkid/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	app := setUpWithConfig(t, `{
+		"port": ":3000",
+		"version": "v1",
+		"db_driver": "memory",
+		"rate_limits": {"ip_read": {"rate": 0.001, "burst": 1}}
+	}`)
+	router := app.router()
+
+	get := func(path string) int {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		return response.Code
+	}
+
+	t.Run("test healthz", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, get("/healthz"))
+	})
+
+	t.Run("test readyz", func(t *testing.T) {
+		// probes are not rate limited
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, get("/readyz"))
+		}
+	})
+
+	t.Run("test readyz not migrated", func(t *testing.T) {
+		db := app.db
+		defer func() { app.db = db }()
+
+		boltStore := store.NewBoltStore()
+		assert.NoError(t, boltStore.SetConn(filepath.Join(t.TempDir(), "pkid.db")))
+		app.db = boltStore
+
+		assert.Equal(t, http.StatusServiceUnavailable, get("/readyz"))
+		assert.Equal(t, http.StatusOK, get("/healthz"))
+	})
+
+	t.Run("test readyz draining", func(t *testing.T) {
+		app.draining.Store(true)
+		defer app.draining.Store(false)
+
+		assert.Equal(t, http.StatusServiceUnavailable, get("/readyz"))
+		assert.Equal(t, http.StatusOK, get("/healthz"), "the server is alive while it drains")
+	})
+}
@@ -0,0 +1,42 @@
+// Package app for pkid app
+package app
+
+import (
+	"io"
+	"os"
+
+	"github.com/rawdaGastan/pkid/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// SetupLogger sets the format and level of the logs, the given format and level override the configured ones if they are not empty.
+// It is set up before the app is created so the logs of creating it have the configured format
+func SetupLogger(conf config.Configuration, format string, level string) error {
+	if format == "" {
+		format = conf.LogFormat
+	}
+
+	if level == "" {
+		level = conf.LogLevel
+	}
+
+	if err := config.ValidateLogs(format, level); err != nil {
+		return err
+	}
+
+	log.Logger = newLogger(os.Stderr, format, level)
+	// logs of contexts without a request logger use the global logger
+	zerolog.DefaultContextLogger = &log.Logger
+	return nil
+}
+
+// newLogger creates a logger of a valid format and level
+func newLogger(out io.Writer, format string, level string) zerolog.Logger {
+	if format == config.LogFormatConsole {
+		out = zerolog.ConsoleWriter{Out: out}
+	}
+
+	lvl, _ := zerolog.ParseLevel(level)
+	return zerolog.New(out).Level(lvl).With().Timestamp().Logger()
+}
@@ -0,0 +1,33 @@
+// Package app for pkid app
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rawdaGastan/pkid/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	t.Run("test json logs", func(t *testing.T) {
+		var logs bytes.Buffer
+		logger := newLogger(&logs, config.LogFormatJSON, "warn")
+
+		logger.Info().Msg("hidden")
+		logger.Warn().Str("pk", "pk").Msg("shown")
+
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+		assert.Equal(t, "shown", line["message"])
+		assert.Equal(t, "pk", line["pk"])
+		assert.Equal(t, "warn", line["level"])
+	})
+
+	t.Run("test invalid overrides", func(t *testing.T) {
+		app := setUp(t)
+		assert.Error(t, SetupLogger(app.config, "xml", ""))
+		assert.Error(t, SetupLogger(app.config, "", "verbose"))
+	})
+}
@@ -0,0 +1,77 @@
+// Package app for pkid app
+package app
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rawdaGastan/pkid/store"
+)
+
+// documentMsg is a got document with its metadata, the write times are missing if they are unknown
+// and the expiry is missing if it never expires
+type documentMsg struct {
+	Message   string     `json:"msg"`
+	Data      string     `json:"data"`
+	Size      int64      `json:"size"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// keyMetadataMsg is a listed key with the revision and metadata of its document
+type keyMetadataMsg struct {
+	Key       string     `json:"key"`
+	Revision  int64      `json:"revision"`
+	Size      int64      `json:"size"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// knownTime gets the time, or nil if it is the zero time of an unknown time or of no expiry
+func knownTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// keyMetadataMsgs converts the listed metadata of the store into listed keys
+func keyMetadataMsgs(metadata []store.KeyMetadata) []keyMetadataMsg {
+	msgs := make([]keyMetadataMsg, 0, len(metadata))
+	for _, m := range metadata {
+		msgs = append(msgs, keyMetadataMsg{
+			Key:       m.Key,
+			Revision:  m.Revision,
+			Size:      m.Size,
+			CreatedAt: knownTime(m.CreatedAt),
+			UpdatedAt: knownTime(m.UpdatedAt),
+			ExpiresAt: knownTime(m.ExpiresAt),
+		})
+	}
+	return msgs
+}
+
+// notModified checks the If-None-Match and If-Modified-Since headers of a get request against the document.
+// If-Modified-Since is ignored if the request has If-None-Match or if the update time of the document is unknown
+func notModified(r *http.Request, doc store.Document) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		revisions, wildcard, err := parseETags(ifNoneMatch)
+		return err == nil && (wildcard || hasRevision(revisions, doc.Revision))
+	}
+
+	ifModifiedSince := strings.TrimSpace(r.Header.Get("If-Modified-Since"))
+	if ifModifiedSince == "" || doc.UpdatedAt.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+
+	// http dates have no fractions of seconds
+	return !doc.UpdatedAt.Truncate(time.Second).After(since)
+}
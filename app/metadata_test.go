@@ -0,0 +1,128 @@
+// Package app for pkid app
+package app
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rawdaGastan/pkid/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentMetadata(t *testing.T) {
+	app := setUp(t)
+
+	privateKey, publicKey, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	before := time.Now()
+	response := httptest.NewRecorder()
+	WrapFunc(app.set).ServeHTTP(response, setRequest(t, privateKey, publicKey, "pkid", "key", "value"))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", "key")
+		req := httptest.NewRequest(http.MethodGet, requestURL, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "key",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.get).ServeHTTP(response, req)
+		return response
+	}
+
+	t.Run("test get metadata", func(t *testing.T) {
+		response := get(nil)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, strconv.Itoa(response.Body.Len()), response.Header().Get("Content-Length"))
+
+		var body documentMsg
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		assert.Equal(t, int64(len(body.Data)), body.Size)
+		assert.NotNil(t, body.CreatedAt)
+		assert.NotNil(t, body.UpdatedAt)
+		assert.False(t, body.UpdatedAt.Before(before))
+
+		lastModified, err := http.ParseTime(response.Header().Get("Last-Modified"))
+		assert.NoError(t, err)
+		assert.True(t, lastModified.Equal(body.UpdatedAt.Truncate(time.Second)))
+	})
+
+	t.Run("test get if modified since", func(t *testing.T) {
+		lastModified := get(nil).Header().Get("Last-Modified")
+
+		response := get(http.Header{"If-Modified-Since": {lastModified}})
+		assert.Equal(t, http.StatusNotModified, response.Code)
+		assert.Empty(t, response.Body.Bytes())
+		assert.NotEmpty(t, response.Header().Get("ETag"))
+		assert.Equal(t, lastModified, response.Header().Get("Last-Modified"))
+
+		earlier := before.Add(-time.Hour).UTC().Format(http.TimeFormat)
+		response = get(http.Header{"If-Modified-Since": {earlier}})
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		response = get(http.Header{"If-Modified-Since": {"not a date"}})
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("test get if none match", func(t *testing.T) {
+		current := get(nil)
+		etag := current.Header().Get("ETag")
+
+		response := get(http.Header{"If-None-Match": {etag}})
+		assert.Equal(t, http.StatusNotModified, response.Code)
+
+		// If-Modified-Since is ignored with If-None-Match
+		response = get(http.Header{
+			"If-None-Match":     {formatETag(100)},
+			"If-Modified-Since": {current.Header().Get("Last-Modified")},
+		})
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("test list metadata", func(t *testing.T) {
+		list := func(query string) *httptest.ResponseRecorder {
+			requestURL := fmt.Sprintf("/%v/%v?%v", hex.EncodeToString(publicKey), "pkid", query)
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, requestURL, nil), map[string]string{
+				"pk":      hex.EncodeToString(publicKey),
+				"project": "pkid",
+			})
+
+			response := httptest.NewRecorder()
+			WrapFunc(app.list).ServeHTTP(response, req)
+			return response
+		}
+
+		var page pageMsg
+		response := list("metadata=true")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &page))
+		assert.Equal(t, []string{"key"}, page.Data)
+		assert.Len(t, page.Metadata, 1)
+		assert.Equal(t, "key", page.Metadata[0].Key)
+		assert.Equal(t, int64(1), page.Metadata[0].Revision)
+		assert.NotZero(t, page.Metadata[0].Size)
+		assert.NotNil(t, page.Metadata[0].UpdatedAt)
+
+		page = pageMsg{}
+		response = list("")
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &page))
+		assert.Empty(t, page.Metadata)
+
+		response = list("metadata=maybe")
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
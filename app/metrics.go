@@ -0,0 +1,91 @@
+// Package app for pkid app
+package app
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rawdaGastan/pkid/store"
+	"github.com/rs/zerolog/log"
+)
+
+// reasons of signature verification failures
+const (
+	reasonMissingHeader    = "missing_header"
+	reasonMalformedHeader  = "malformed_header"
+	reasonHeaderSignature  = "invalid_header_signature"
+	reasonClockSkew        = "clock_skew"
+	reasonHeaderVersion    = "unsupported_header_version"
+	reasonHeaderClaims     = "invalid_header_claims"
+	reasonReplayedNonce    = "replayed_nonce"
+	reasonPayloadSignature = "invalid_payload_signature"
+)
+
+// headerFailureReason gets the reason of a failed signed header verification
+func headerFailureReason(err error) string {
+	switch {
+	case errors.Is(err, errHeaderSignature):
+		return reasonHeaderSignature
+	case errors.Is(err, errClockSkew):
+		return reasonClockSkew
+	default:
+		return reasonMalformedHeader
+	}
+}
+
+// newNonceCollector creates a gauge of the number of remembered nonces of signed headers
+func newNonceCollector(nonces *nonceCache) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "pkid",
+		Name:      "nonces",
+		Help:      "Number of remembered nonces of signed headers.",
+	}, func() float64 {
+		return float64(nonces.size())
+	})
+}
+
+// storeCollector reports the number of stored keys and projects, they are counted by refresh
+// so scrapes don't query the store
+type storeCollector struct {
+	db           store.PkidStore
+	keys         *prometheus.Desc
+	projects     *prometheus.Desc
+	keyCount     atomic.Int64
+	projectCount atomic.Int64
+}
+
+// newStoreCollector creates a collector of the stored keys and projects
+func newStoreCollector(db store.PkidStore) *storeCollector {
+	return &storeCollector{
+		db:       db,
+		keys:     prometheus.NewDesc("pkid_keys", "Number of stored keys.", nil, nil),
+		projects: prometheus.NewDesc("pkid_projects", "Number of projects of all public keys.", nil, nil),
+	}
+}
+
+// refresh counts the stored keys and projects, the last counts are kept if it fails
+func (c *storeCollector) refresh(ctx context.Context) {
+	keys, projects, err := c.db.Count(ctx)
+	if err != nil {
+		// the failure is reported by pkid_store_errors_total
+		log.Error().Err(err).Msg("failed to count stored keys")
+		return
+	}
+
+	c.keyCount.Store(keys)
+	c.projectCount.Store(projects)
+}
+
+// Describe implements prometheus.Collector
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.keys
+	ch <- c.projects
+}
+
+// Collect implements prometheus.Collector
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(c.keyCount.Load()))
+	ch <- prometheus.MustNewConstMetric(c.projects, prometheus.GaugeValue, float64(c.projectCount.Load()))
+}
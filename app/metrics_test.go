@@ -0,0 +1,69 @@
+// Package app for pkid app
+package app
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rawdaGastan/pkid/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	app := setUp(t)
+	router := app.router()
+
+	privateKey, publicKey, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+	pk := hex.EncodeToString(publicKey)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	// a stored key
+	signedBody := signedPayload(t, privateKey, "value")
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/%s/pkid/key", pk), bytes.NewReader([]byte(signedBody)))
+	req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", "key", []byte(signedBody)))
+	assert.Equal(t, http.StatusCreated, serve(req).Code)
+
+	// a missing key
+	assert.Equal(t, http.StatusNotFound, serve(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/%s/pkid/missing", pk), nil)).Code)
+
+	// a header signed by another key
+	otherKey, _, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/%s/pkid/key", pk), nil)
+	req.Header.Set("Authorization", signHeader(t, otherKey, http.MethodDelete, intentDelete, "pkid", "key", nil))
+	assert.Equal(t, http.StatusUnauthorized, serve(req).Code)
+
+	// the stored keys are counted by the sweeper
+	app.sweep()
+
+	response := serve(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	body, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+
+	for _, metric := range []string{
+		`pkid_http_requests_total{method="POST",route="/v1/{pk}/{project}/{key}",status="201"} 1`,
+		`pkid_http_requests_total{method="GET",route="/v1/{pk}/{project}/{key}",status="404"} 1`,
+		`pkid_http_request_duration_seconds_count{method="DELETE",route="/v1/{pk}/{project}/{key}",status="401"} 1`,
+		`pkid_signature_failures_total{reason="invalid_header_signature"} 1`,
+		`pkid_store_operation_duration_seconds_count{driver="memory",operation="set"} 1`,
+		`pkid_keys 1`,
+		`pkid_projects 1`,
+		`pkid_nonces 1`,
+	} {
+		assert.Contains(t, string(body), metric)
+	}
+	assert.NotContains(t, string(body), "pkid_store_errors_total", "a missing key is not a store error")
+}
@@ -0,0 +1,84 @@
+// Package app for pkid app
+package app
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// errNonceUsed is an error of a nonce that is already used by an accepted signed header
+	errNonceUsed = errors.New("nonce is already used")
+	// errNonceCacheFull is an error of a nonce that can't be remembered as the cache is full of nonces that didn't expire
+	errNonceCacheFull = errors.New("nonce cache is full")
+)
+
+// nonceCache remembers the nonces of the accepted signed headers until their timestamps expire,
+// so the same header can't be replayed. It is bounded, nonces are rejected while it is full rather than
+// forgetting live ones as a forgotten nonce could be replayed
+type nonceCache struct {
+	mutex     sync.Mutex
+	nonces    map[string]time.Time
+	ttl       time.Duration
+	max       int
+	lastSweep time.Time
+}
+
+// newNonceCache creates a new nonce cache of at most max nonces, 0 is not limited.
+// Expired nonces are swept at most once per ttl or when the cache is full
+func newNonceCache(ttl time.Duration, max int) *nonceCache {
+	return &nonceCache{
+		nonces: map[string]time.Time{},
+		ttl:    ttl,
+		max:    max,
+	}
+}
+
+// use records the nonce until it expires, it fails if the nonce is already used or if the cache is full
+func (c *nonceCache) use(nonce string, expiresAt time.Time, now time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if now.Sub(c.lastSweep) >= c.ttl {
+		c.sweep(now)
+	}
+
+	expiry, ok := c.nonces[nonce]
+	if ok && expiry.After(now) {
+		return errNonceUsed
+	}
+
+	if !ok && c.full() {
+		c.sweep(now)
+		if c.full() {
+			return errNonceCacheFull
+		}
+	}
+
+	c.nonces[nonce] = expiresAt
+	return nil
+}
+
+// size gets the number of remembered nonces
+func (c *nonceCache) size() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.nonces)
+}
+
+// full checks if no more nonces can be remembered
+func (c *nonceCache) full() bool {
+	return c.max > 0 && len(c.nonces) >= c.max
+}
+
+// sweep removes the expired nonces
+func (c *nonceCache) sweep(now time.Time) {
+	for nonce, expiry := range c.nonces {
+		if !expiry.After(now) {
+			delete(c.nonces, nonce)
+		}
+	}
+	c.lastSweep = now
+}
@@ -0,0 +1,79 @@
+// Package app for pkid app
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rawdaGastan/pkid/client"
+	"github.com/rawdaGastan/pkid/pkg"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonceCache(t *testing.T) {
+	now := time.Now()
+	cache := newNonceCache(5*time.Second, 0)
+
+	t.Run("test use", func(t *testing.T) {
+		assert.NoError(t, cache.use("nonce", now.Add(5*time.Second), now))
+	})
+
+	t.Run("test reuse", func(t *testing.T) {
+		assert.ErrorIs(t, cache.use("nonce", now.Add(5*time.Second), now.Add(time.Second)), errNonceUsed)
+	})
+
+	t.Run("test reuse after expiry", func(t *testing.T) {
+		assert.NoError(t, cache.use("nonce", now.Add(15*time.Second), now.Add(10*time.Second)))
+	})
+
+	t.Run("test sweep", func(t *testing.T) {
+		assert.NoError(t, cache.use("other", now.Add(16*time.Second), now.Add(11*time.Second)))
+		assert.NoError(t, cache.use("new", now.Add(30*time.Second), now.Add(20*time.Second)))
+		assert.Equal(t, 1, cache.size())
+	})
+}
+
+func TestNonceCacheLimit(t *testing.T) {
+	now := time.Now()
+	cache := newNonceCache(time.Minute, 2)
+
+	assert.NoError(t, cache.use("first", now.Add(5*time.Second), now))
+	assert.NoError(t, cache.use("second", now.Add(10*time.Second), now))
+
+	t.Run("test full", func(t *testing.T) {
+		assert.ErrorIs(t, cache.use("third", now.Add(5*time.Second), now.Add(time.Second)), errNonceCacheFull)
+		assert.ErrorIs(t, cache.use("first", now.Add(5*time.Second), now.Add(time.Second)), errNonceUsed)
+		assert.Equal(t, 2, cache.size())
+	})
+
+	t.Run("test full sweeps expired nonces", func(t *testing.T) {
+		// the sweep interval didn't pass, the full cache is swept
+		assert.NoError(t, cache.use("third", now.Add(15*time.Second), now.Add(6*time.Second)))
+		assert.Equal(t, 2, cache.size())
+	})
+}
+
+func TestNonceCacheFull(t *testing.T) {
+	app := setUpWithConfig(t, `{
+		"port": ":3000",
+		"version": "v1",
+		"db_driver": "memory",
+		"max_nonces": 1
+	}`)
+
+	privateKey, publicKey, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	response := httptest.NewRecorder()
+	WrapFunc(app.set).ServeHTTP(response, setRequest(t, privateKey, publicKey, "pkid", "first", "value"))
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	response = httptest.NewRecorder()
+	WrapFunc(app.set).ServeHTTP(response, setRequest(t, privateKey, publicKey, "pkid", "second", "value"))
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, pkg.CodeRateLimited, errorCode(t, response))
+	assert.Equal(t, "5", response.Header().Get("Retry-After"))
+}
@@ -0,0 +1,81 @@
+// Package app for pkid app
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/rawdaGastan/pkid/store"
+)
+
+const (
+	// defaultListLimit is the number of listed keys of a page if the request has no limit
+	defaultListLimit = 100
+	// maxListLimit is the max number of listed keys of a page
+	maxListLimit = 1000
+)
+
+// pageMsg is a page of listed keys, the next page is listed with the next cursor.
+// Metadata has the metadata of the listed keys in the same order if it is requested
+type pageMsg struct {
+	Message    string           `json:"msg"`
+	Data       []string         `json:"data"`
+	Metadata   []keyMetadataMsg `json:"metadata,omitempty"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// encodeCursor encodes the last listed key of a page as the cursor of the next page
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// decodeCursor decodes a cursor into the last listed key of the previous page
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", errors.New("invalid cursor")
+	}
+
+	return string(key), nil
+}
+
+// listOptions parses the limit, cursor and prefix query parameters of a list request
+func listOptions(query url.Values) (store.ListOptions, Response) {
+	opts := store.ListOptions{Prefix: query.Get("prefix"), Limit: defaultListLimit}
+
+	if query.Has("limit") {
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			return store.ListOptions{}, BadRequest(fmt.Errorf("limit should be between 1 and %d", maxListLimit)).
+				WithDetails(map[string]interface{}{"limit": maxListLimit})
+		}
+		opts.Limit = limit
+	}
+
+	if query.Has("cursor") {
+		after, err := decodeCursor(query.Get("cursor"))
+		if err != nil {
+			return store.ListOptions{}, BadRequest(err)
+		}
+		opts.After = after
+	}
+
+	return opts, nil
+}
+
+// listMetadata parses the metadata query parameter of a list request, the metadata of the keys is listed if it is true
+func listMetadata(query url.Values) (bool, Response) {
+	if !query.Has("metadata") {
+		return false, nil
+	}
+
+	withMetadata, err := strconv.ParseBool(query.Get("metadata"))
+	if err != nil {
+		return false, BadRequest(errors.New("metadata should be true or false"))
+	}
+
+	return withMetadata, nil
+}
@@ -0,0 +1,99 @@
+// Package app for pkid app
+package app
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rawdaGastan/pkid/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPages(t *testing.T) {
+	app := setUp(t)
+
+	privateKey, publicKey, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	for _, key := range []string{"user-2", "user-1", "admin", "user-3"} {
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, setRequest(t, privateKey, publicKey, "pkid", key, "value"))
+		assert.Equal(t, http.StatusCreated, response.Code)
+	}
+
+	list := func(query url.Values) (*httptest.ResponseRecorder, pageMsg) {
+		requestURL := fmt.Sprintf("/%v/%v?%v", hex.EncodeToString(publicKey), "pkid", query.Encode())
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, requestURL, nil), map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.list).ServeHTTP(response, req)
+
+		var page pageMsg
+		if response.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &page))
+		}
+		return response, page
+	}
+
+	t.Run("test list all", func(t *testing.T) {
+		_, page := list(url.Values{})
+		assert.Equal(t, []string{"admin", "user-1", "user-2", "user-3"}, page.Data)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("test list pages", func(t *testing.T) {
+		var keys []string
+		query := url.Values{"limit": {"3"}}
+		pages := 0
+		for {
+			response, page := list(query)
+			assert.Equal(t, http.StatusOK, response.Code)
+			keys = append(keys, page.Data...)
+			pages++
+
+			if page.NextCursor == "" {
+				break
+			}
+			query.Set("cursor", page.NextCursor)
+		}
+
+		assert.Equal(t, 2, pages)
+		assert.Equal(t, []string{"admin", "user-1", "user-2", "user-3"}, keys)
+	})
+
+	t.Run("test list exact page", func(t *testing.T) {
+		_, page := list(url.Values{"limit": {"4"}})
+		assert.Len(t, page.Data, 4)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("test list prefix", func(t *testing.T) {
+		_, page := list(url.Values{"prefix": {"user-"}, "limit": {"2"}})
+		assert.Equal(t, []string{"user-1", "user-2"}, page.Data)
+
+		_, page = list(url.Values{"prefix": {"user-"}, "cursor": {page.NextCursor}})
+		assert.Equal(t, []string{"user-3"}, page.Data)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("test list invalid limit", func(t *testing.T) {
+		for _, limit := range []string{"0", "-1", "a", fmt.Sprint(maxListLimit + 1)} {
+			response, _ := list(url.Values{"limit": {limit}})
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		}
+	})
+
+	t.Run("test list invalid cursor", func(t *testing.T) {
+		response, _ := list(url.Values{"cursor": {"not a cursor"}})
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
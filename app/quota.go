@@ -0,0 +1,119 @@
+// Package app for pkid app
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rawdaGastan/pkid/pkg"
+	"github.com/rawdaGastan/pkid/store"
+	"github.com/rs/zerolog/log"
+)
+
+// reservedNames are the path segments of routes like `/{pk}/_usage`, so projects and keys can't be set with them.
+// Other names starting with `_` are allowed, documents that were set with them stay writable
+var reservedNames = map[string]bool{
+	"_batch": true,
+	"_usage": true,
+}
+
+// validateNames checks that the project and key names are not reserved
+func validateNames(names ...string) Response {
+	for _, name := range names {
+		if reservedNames[name] {
+			return BadRequest(fmt.Errorf("name %s is reserved", name)).
+				WithCode(pkg.CodeInvalidName).
+				WithDetails(map[string]interface{}{"name": name})
+		}
+	}
+	return nil
+}
+
+// readBody reads the request body, it fails if the body is larger than the configured max body size
+func (a *App) readBody(r *http.Request) ([]byte, Response) {
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(http.MaxBytesReader(nil, r.Body, a.config.MaxBodySize))
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, PayloadTooLarge(fmt.Errorf("request body is larger than %d bytes", maxBytesErr.Limit)).
+			WithCode(pkg.CodeBodyTooLarge).
+			WithDetails(map[string]interface{}{"limit": maxBytesErr.Limit})
+	}
+
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Send()
+		return nil, BadRequest(errors.New(("failed to read body")))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// checkQuota checks that writing a value of the given size to the document keeps its public key within the configured quotas.
+// Quotas are checked before the write, so concurrent writes can exceed them slightly
+func (a *App) checkQuota(ctx context.Context, key store.DocKey, size int64) Response {
+	return a.checkProjectQuota(ctx, key.Pk, key.Project, map[string]int64{key.Key: size})
+}
+
+// checkProjectQuota checks that writing values of the given sizes to the keys of a project keeps its public key
+// within the configured quotas
+func (a *App) checkProjectQuota(ctx context.Context, pk string, projectName string, sizes map[string]int64) Response {
+	if a.config.MaxProjectsPerPk == 0 && a.config.MaxKeysPerProject == 0 && a.config.MaxBytesPerPk == 0 {
+		return nil
+	}
+
+	usage, err := a.db.Usage(ctx, pk)
+	if err != nil {
+		return storeError(ctx, err, InternalServerError(errors.New("db usage failed")))
+	}
+
+	var newKeys int
+	var newBytes int64
+	for key, size := range sizes {
+		current, err := a.db.Get(ctx, store.DocKey{Pk: pk, Project: projectName, Key: key})
+		if err != nil && !errors.Is(err, store.ErrNotExists) {
+			return storeError(ctx, err, InternalServerError(errors.New("database get failed")))
+		}
+		if errors.Is(err, store.ErrNotExists) {
+			newKeys++
+		}
+		newBytes += size - int64(len(current.Value))
+	}
+
+	var project *store.ProjectUsage
+	var totalBytes int64
+	for i := range usage {
+		if usage[i].Project == projectName {
+			project = &usage[i]
+		}
+		totalBytes += usage[i].Bytes
+	}
+
+	if project == nil && a.config.MaxProjectsPerPk > 0 && len(usage) >= a.config.MaxProjectsPerPk {
+		return TooManyRequests(
+			fmt.Errorf("quota of %d projects is exceeded", a.config.MaxProjectsPerPk),
+		).WithCode(pkg.CodeProjectsQuotaExceeded).WithDetails(map[string]interface{}{"limit": a.config.MaxProjectsPerPk})
+	}
+
+	var projectKeys int
+	if project != nil {
+		projectKeys = project.Keys
+	}
+
+	if newKeys > 0 && a.config.MaxKeysPerProject > 0 && projectKeys+newKeys > a.config.MaxKeysPerProject {
+		return TooManyRequests(
+			fmt.Errorf("quota of %d keys in project %s is exceeded", a.config.MaxKeysPerProject, projectName),
+		).WithCode(pkg.CodeKeysQuotaExceeded).WithDetails(map[string]interface{}{"limit": a.config.MaxKeysPerProject})
+	}
+
+	if a.config.MaxBytesPerPk > 0 && totalBytes+newBytes > a.config.MaxBytesPerPk {
+		return TooManyRequests(
+			fmt.Errorf("quota of %d bytes is exceeded", a.config.MaxBytesPerPk),
+		).WithCode(pkg.CodeBytesQuotaExceeded).WithDetails(map[string]interface{}{"limit": a.config.MaxBytesPerPk})
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+// Package app for pkid app
+package app
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rawdaGastan/pkid/client"
+	"github.com/rawdaGastan/pkid/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// setRequest creates a signed set request of the given value
+func setRequest(t testing.TB, privateKey, publicKey []byte, project, key, value string) *http.Request {
+	signedBody := signedPayload(t, privateKey, value)
+	signedHeader := signHeader(t, privateKey, http.MethodPost, intentStore, project, key, []byte(signedBody))
+
+	requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), project, key)
+	req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+	req.Header.Set("Authorization", signedHeader)
+
+	return mux.SetURLVars(req, map[string]string{
+		"pk":      hex.EncodeToString(publicKey),
+		"project": project,
+		"key":     key,
+	})
+}
+
+// errorCode gets the code of an error response
+func errorCode(t testing.TB, response *httptest.ResponseRecorder) string {
+	var body struct {
+		Code string `json:"code"`
+	}
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+
+	return body.Code
+}
+
+func TestQuotas(t *testing.T) {
+	privateKey, publicKey, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	valueSize := len(signedPayload(t, privateKey, "value"))
+
+	app := setUpWithConfig(t, fmt.Sprintf(`{
+		"port": ":3000",
+		"version": "v1",
+		"db_driver": "memory",
+		"max_body_size": 1024,
+		"max_keys_per_project": 2,
+		"max_projects_per_pk": 2,
+		"max_bytes_per_pk": %d
+	}`, 4*valueSize))
+
+	set := func(project, key, value string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, setRequest(t, privateKey, publicKey, project, key, value))
+		return response
+	}
+
+	t.Run("test body too large", func(t *testing.T) {
+		response := set("pkid", "key", strings.Repeat("v", 1024))
+		assert.Equal(t, response.Code, http.StatusRequestEntityTooLarge)
+		assert.Equal(t, pkg.CodeBodyTooLarge, errorCode(t, response))
+	})
+
+	t.Run("test reserved names", func(t *testing.T) {
+		response := set("_usage", "key", "value")
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+
+		response = set("pkid", "_batch", "value")
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+		assert.Equal(t, pkg.CodeInvalidName, errorCode(t, response))
+	})
+
+	t.Run("test keys quota", func(t *testing.T) {
+		assert.Equal(t, set("pkid", "key", "value").Code, http.StatusCreated)
+		assert.Equal(t, set("pkid", "other", "value").Code, http.StatusCreated)
+
+		// overwriting an existing key doesn't add a key
+		assert.Equal(t, set("pkid", "key", "value").Code, http.StatusCreated)
+
+		response := set("pkid", "third", "value")
+		assert.Equal(t, response.Code, http.StatusTooManyRequests)
+		assert.Equal(t, pkg.CodeKeysQuotaExceeded, errorCode(t, response))
+	})
+
+	t.Run("test projects quota", func(t *testing.T) {
+		assert.Equal(t, set("other", "key", "value").Code, http.StatusCreated)
+
+		response := set("third", "key", "value")
+		assert.Equal(t, response.Code, http.StatusTooManyRequests)
+		assert.Equal(t, pkg.CodeProjectsQuotaExceeded, errorCode(t, response))
+	})
+
+	t.Run("test bytes quota", func(t *testing.T) {
+		assert.Equal(t, set("other", "other", "value").Code, http.StatusCreated)
+
+		// the 4 stored values use the whole quota, so only a smaller value fits
+		response := set("other", "other", "larger value")
+		assert.Equal(t, response.Code, http.StatusTooManyRequests)
+		assert.Equal(t, pkg.CodeBytesQuotaExceeded, errorCode(t, response))
+
+		assert.Equal(t, set("other", "other", "v").Code, http.StatusCreated)
+	})
+
+	t.Run("test usage", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%v/_usage", hex.EncodeToString(publicKey)), nil)
+		req = mux.SetURLVars(req, map[string]string{"pk": hex.EncodeToString(publicKey)})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.usage).ServeHTTP(response, req)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		var body struct {
+			Data usageMsg `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		assert.Equal(t, 2, body.Data.Projects)
+		assert.Equal(t, 4, body.Data.Keys)
+		assert.Equal(t, 2, body.Data.MaxKeysPerProject)
+		assert.Equal(t, []projectUsageMsg{
+			{Project: "other", Keys: 2, Bytes: body.Data.PerProject[0].Bytes},
+			{Project: "pkid", Keys: 2, Bytes: int64(2 * valueSize)},
+		}, body.Data.PerProject)
+	})
+}
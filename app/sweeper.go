@@ -0,0 +1,56 @@
+// Package app for pkid app
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sweeper purges the expired documents of the store and counts the stored ones in the background
+type sweeper struct {
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+// startSweeper starts purging the expired documents on each tick until the sweeper is stopped
+func (a *App) startSweeper(ticks <-chan time.Time) *sweeper {
+	s := &sweeper{stopped: make(chan struct{}), done: make(chan struct{})}
+
+	go func() {
+		defer close(s.done)
+		for {
+			select {
+			case <-s.stopped:
+				return
+			case <-ticks:
+				a.sweep()
+			}
+		}
+	}()
+
+	return s
+}
+
+// stop stops the sweeper and waits for a running purge to finish
+func (s *sweeper) stop() {
+	close(s.stopped)
+	<-s.done
+}
+
+// sweep deletes the expired documents then counts the stored keys and projects of the metrics,
+// a failed purge is retried on the next tick
+func (a *App) sweep() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.config.DBTimeout)*time.Second)
+	defer cancel()
+
+	deleted, err := a.db.DeleteExpired(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete expired documents")
+	} else if deleted > 0 {
+		log.Info().Int64("deleted", deleted).Msg("Expired documents are deleted")
+	}
+
+	a.counts.refresh(ctx)
+}
@@ -0,0 +1,183 @@
+// Package app for pkid app
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rawdaGastan/pkid/client"
+	"github.com/rawdaGastan/pkid/pkg"
+	"github.com/rawdaGastan/pkid/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// expiringSetRequest creates a signed set request of a value with the given expiry fields of the envelope
+func expiringSetRequest(t testing.TB, privateKey, publicKey []byte, key string, expiry map[string]interface{}) *http.Request {
+	payload := map[string]interface{}{
+		"is_encrypted": false,
+		"payload":      "value",
+		"data_version": 1,
+	}
+	for field, value := range expiry {
+		payload[field] = value
+	}
+
+	signedBody, err := pkg.SignEncode(payload, privateKey)
+	assert.NoError(t, err)
+
+	requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", key)
+	req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader([]byte(signedBody)))
+	req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentStore, "pkid", key, []byte(signedBody)))
+
+	return mux.SetURLVars(req, map[string]string{
+		"pk":      hex.EncodeToString(publicKey),
+		"project": "pkid",
+		"key":     key,
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	app := setUp(t)
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+	app.now = clock
+	app.db.SetClock(clock)
+
+	privateKey, publicKey, err := client.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	get := func(key string) *httptest.ResponseRecorder {
+		requestURL := fmt.Sprintf("/%v/%v/%v", hex.EncodeToString(publicKey), "pkid", key)
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, requestURL, nil), map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     key,
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.get).ServeHTTP(response, req)
+		return response
+	}
+
+	t.Run("test set with ttl", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, expiringSetRequest(t, privateKey, publicKey, "expiring", map[string]interface{}{"ttl": 60}))
+		assert.Equal(t, http.StatusCreated, response.Code)
+
+		response = httptest.NewRecorder()
+		WrapFunc(app.set).ServeHTTP(response, setRequest(t, privateKey, publicKey, "pkid", "kept", "value"))
+		assert.Equal(t, http.StatusCreated, response.Code)
+
+		response = get("expiring")
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var body documentMsg
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		assert.NotNil(t, body.ExpiresAt)
+		assert.True(t, body.ExpiresAt.Equal(now.Add(time.Minute)))
+
+		body = documentMsg{}
+		assert.NoError(t, json.Unmarshal(get("kept").Body.Bytes(), &body))
+		assert.Nil(t, body.ExpiresAt)
+	})
+
+	t.Run("test restore keeps expiry", func(t *testing.T) {
+		body := []byte(`{"revision": 1}`)
+
+		requestURL := fmt.Sprintf("/%v/%v/%v/restore", hex.EncodeToString(publicKey), "pkid", "expiring")
+		req := httptest.NewRequest(http.MethodPost, requestURL, bytes.NewReader(body))
+		req.Header.Set("Authorization", signHeader(t, privateKey, http.MethodPost, intentRestore, "pkid", "expiring", body))
+		req = mux.SetURLVars(req, map[string]string{
+			"pk":      hex.EncodeToString(publicKey),
+			"project": "pkid",
+			"key":     "expiring",
+		})
+
+		response := httptest.NewRecorder()
+		WrapFunc(app.restore).ServeHTTP(response, req)
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.Equal(t, `"2"`, response.Header().Get("ETag"))
+
+		var doc documentMsg
+		assert.NoError(t, json.Unmarshal(get("expiring").Body.Bytes(), &doc))
+		assert.NotNil(t, doc.ExpiresAt)
+		assert.True(t, doc.ExpiresAt.Equal(now.Add(time.Minute)))
+	})
+
+	t.Run("test set with invalid expiry", func(t *testing.T) {
+		for _, expiry := range []map[string]interface{}{
+			{"ttl": -1},
+			{"expires_at": now.Add(-time.Minute).Unix()},
+			{"ttl": 60, "expires_at": now.Add(time.Minute).Unix()},
+			{"ttl": math.MaxInt64},
+			{"ttl": math.MaxInt64 / int64(time.Second)},
+			{"expires_at": math.MaxInt64},
+			{"expires_at": maxExpiry.Unix() + 1},
+		} {
+			response := httptest.NewRecorder()
+			WrapFunc(app.set).ServeHTTP(response, expiringSetRequest(t, privateKey, publicKey, "invalid", expiry))
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+			assert.Equal(t, pkg.CodePayloadInvalid, errorCode(t, response))
+		}
+	})
+
+	t.Run("test get expired", func(t *testing.T) {
+		now = now.Add(time.Minute)
+
+		response := get("expiring")
+		assert.Equal(t, http.StatusNotFound, response.Code)
+
+		response = get("kept")
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("test sweep expired", func(t *testing.T) {
+		ticks := make(chan time.Time)
+		sweeper := app.startSweeper(ticks)
+
+		// the tick is received once the sweeper is waiting for it, stop waits for the purge to finish
+		ticks <- now
+		sweeper.stop()
+
+		select {
+		case <-sweeper.done:
+		default:
+			t.Fatal("sweeper should be stopped")
+		}
+
+		// the purged document is not found even before its expiry
+		now = now.Add(-time.Minute)
+		_, err := app.db.Get(context.Background(), store.DocKey{Pk: hex.EncodeToString(publicKey), Project: "pkid", Key: "expiring"})
+		assert.True(t, errors.Is(err, store.ErrNotExists))
+
+		_, err = app.db.Get(context.Background(), store.DocKey{Pk: hex.EncodeToString(publicKey), Project: "pkid", Key: "kept"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("test stop idle sweeper", func(t *testing.T) {
+		sweeper := app.startSweeper(make(chan time.Time))
+
+		stopped := make(chan struct{})
+		go func() {
+			sweeper.stop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("sweeper should stop without ticks")
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// Package app for pkid app
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/rawdaGastan/pkid/config"
+)
+
+// certReloader keeps the server certificate and the authorities of client certificates,
+// so they can be replaced without restarting the server
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mutex     sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// newCertReloader loads the certificate with its key and the client CA bundle if it is given
+func newCertReloader(conf config.TLS) (*certReloader, error) {
+	reloader := &certReloader{certFile: conf.CertFile, keyFile: conf.KeyFile, clientCAFile: conf.ClientCAFile}
+	return reloader, reloader.reload()
+}
+
+// reload loads the certificate, its key and the client CA bundle again,
+// the current ones are all kept if any of them is invalid
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if c.clientCAFile != "" {
+		if clientCAs, err = loadCertPool(c.clientCAFile); err != nil {
+			return err
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	return nil
+}
+
+// getCertificate returns the current certificate of each handshake
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.cert, nil
+}
+
+// getClientCAs returns the current authorities of client certificates
+func (c *certReloader) getClientCAs() *x509.CertPool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.clientCAs
+}
+
+// tlsConfig creates the tls configurations of the server, client certificates are required
+// and verified with the current client CA bundle of each handshake if it is configured
+func tlsConfig(certs *certReloader) *tls.Config {
+	tlsConf := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+	}
+
+	if certs.clientCAFile == "" {
+		return tlsConf
+	}
+
+	tlsConf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		clientConf := tlsConf.Clone()
+		clientConf.GetConfigForClient = nil
+		clientConf.ClientCAs = certs.getClientCAs()
+		clientConf.ClientAuth = tls.RequireAndVerifyClientCert
+		return clientConf, nil
+	}
+	return tlsConf
+}
+
+// loadCertPool loads a PEM bundle of certificates
+func loadCertPool(file string) (*x509.CertPool, error) {
+	bundle, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificates bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,217 @@
+// Package app for pkid app
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rawdaGastan/pkid/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCert is a generated certificate with its PEM files
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert generates a certificate for localhost signed by the given parent, it is self signed if parent is nil
+func newTestCert(t testing.TB, name string, parent *testCert) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	assert.NoError(t, err)
+
+	return testCert{cert: cert, key: key, certFile: certFile, keyFile: keyFile}
+}
+
+// copyFile copies the content of a file to another one
+func copyFile(t testing.TB, from, to string) {
+	content, err := os.ReadFile(from)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(to, content, 0600))
+}
+
+func TestCertReloader(t *testing.T) {
+	first := newTestCert(t, "first", nil)
+	second := newTestCert(t, "second", nil)
+
+	t.Run("invalid certificate", func(t *testing.T) {
+		_, err := newCertReloader(config.TLS{CertFile: first.certFile, KeyFile: second.keyFile})
+		assert.Error(t, err)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		certFile := filepath.Join(t.TempDir(), "server.crt")
+		keyFile := filepath.Join(t.TempDir(), "server.key")
+
+		copyFile(t, first.certFile, certFile)
+		copyFile(t, first.keyFile, keyFile)
+
+		certs, err := newCertReloader(config.TLS{CertFile: certFile, KeyFile: keyFile})
+		assert.NoError(t, err)
+
+		cert, err := certs.getCertificate(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, first.cert.Raw, cert.Certificate[0])
+
+		// a half written certificate keeps the current one
+		copyFile(t, second.certFile, certFile)
+		assert.Error(t, certs.reload())
+
+		cert, err = certs.getCertificate(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, first.cert.Raw, cert.Certificate[0])
+
+		copyFile(t, second.keyFile, keyFile)
+		assert.NoError(t, certs.reload())
+
+		cert, err = certs.getCertificate(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, second.cert.Raw, cert.Certificate[0])
+	})
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "server", &ca)
+	client := newTestCert(t, "client", &ca)
+	other := newTestCert(t, "other", nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// get sends a request to the server with the given client certificates
+	get := func(t *testing.T, url string, clientCerts ...testCert) error {
+		tlsConf := &tls.Config{RootCAs: roots}
+		for _, c := range clientCerts {
+			cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+			assert.NoError(t, err)
+			tlsConf.Certificates = append(tlsConf.Certificates, cert)
+		}
+
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConf}}
+		response, err := httpClient.Get(url)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		return nil
+	}
+
+	// serve starts a tls server with the given certificates
+	serve := func(t *testing.T, certs *certReloader) string {
+		tlsConf := tlsConfig(certs)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+
+		srv := &http.Server{
+			Handler:  http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+			ErrorLog: log.New(io.Discard, "", 0),
+		}
+		go func() { _ = srv.Serve(tls.NewListener(listener, tlsConf)) }()
+		t.Cleanup(func() { srv.Close() })
+
+		return "https://" + listener.Addr().String()
+	}
+
+	t.Run("tls", func(t *testing.T) {
+		certs, err := newCertReloader(config.TLS{CertFile: server.certFile, KeyFile: server.keyFile})
+		assert.NoError(t, err)
+
+		url := serve(t, certs)
+		assert.NoError(t, get(t, url))
+	})
+
+	t.Run("mutual tls", func(t *testing.T) {
+		certs, err := newCertReloader(config.TLS{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: ca.certFile})
+		assert.NoError(t, err)
+
+		url := serve(t, certs)
+		assert.NoError(t, get(t, url, client))
+		assert.Error(t, get(t, url), "clients without certificates should be rejected")
+		assert.Error(t, get(t, url, other), "clients with unknown certificates should be rejected")
+	})
+
+	t.Run("reload client ca", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.crt")
+		copyFile(t, ca.certFile, caFile)
+
+		certs, err := newCertReloader(config.TLS{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: caFile})
+		assert.NoError(t, err)
+
+		url := serve(t, certs)
+		assert.Error(t, get(t, url, other))
+
+		// an invalid bundle keeps the current one
+		assert.NoError(t, os.WriteFile(caFile, []byte("bundle"), 0600))
+		assert.Error(t, certs.reload())
+		assert.NoError(t, get(t, url, client))
+
+		copyFile(t, other.certFile, caFile)
+		assert.NoError(t, certs.reload())
+		assert.NoError(t, get(t, url, other))
+		assert.Error(t, get(t, url, client), "clients of the replaced authority should be rejected")
+	})
+
+	t.Run("invalid client ca", func(t *testing.T) {
+		_, err := newCertReloader(config.TLS{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: server.keyFile})
+		assert.Error(t, err)
+	})
+}
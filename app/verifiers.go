@@ -2,16 +2,69 @@
 package app
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"golang.org/x/crypto/nacl/sign"
 )
 
-// verify the signed data (value) of the set request body
-func verifySignedData(data string, pk []byte) (bool, error) {
+const (
+	intentStore         = "pkid.store"
+	intentDelete        = "pkid.delete"
+	intentDeleteProject = "pkid.delete_project"
+	intentRestore       = "pkid.restore"
+	intentBatch         = "pkid.batch"
+)
+
+// legacyIntents are the intents that can still be signed with the deprecated legacy headers,
+// only sets were signed before the headers were versioned
+var legacyIntents = map[string]bool{
+	intentStore: true,
+}
+
+var (
+	// errHeaderSignature is an error when the signature of a header doesn't match the public key
+	errHeaderSignature = errors.New("header signature verification failed")
+	// errClockSkew is an error when the timestamp of a header is not within the allowed clock skew
+	errClockSkew = errors.New("timestamp difference exceeded")
+)
+
+// headerVersion is the version of signed headers that are bound to the method, project, key and body hash of the request.
+// Headers without a version are deprecated legacy headers
+const headerVersion = 2
+
+// signedRequest is what the signed header of a request should be bound to
+type signedRequest struct {
+	intent  string
+	method  string
+	project string
+	key     string
+	body    []byte
+}
+
+// claims returns the fields the signed header of the request should hold for the given header version
+func (req signedRequest) claims(version int) map[string]string {
+	if version == headerVersion {
+		return map[string]string{
+			"intent":    req.intent,
+			"method":    req.method,
+			"project":   req.project,
+			"key":       req.key,
+			"body_hash": hashBody(req.body),
+		}
+	}
+
+	// legacy headers are only bound to their intent
+	return map[string]string{"intent": req.intent}
+}
+
+// verify the signed data (value) of the set request body and get the signed payload
+func verifySignedData(data string, pk []byte) ([]byte, error) {
 
 	// pk in bytes
 	verifyPk := [32]byte{}
@@ -19,17 +72,20 @@ func verifySignedData(data string, pk []byte) (bool, error) {
 
 	decodedData, err := base64.StdEncoding.DecodeString(data)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	decodedDataOut := []byte{}
-	_, verified := sign.Open(decodedDataOut, decodedData, &verifyPk)
+	payload, verified := sign.Open(decodedDataOut, decodedData, &verifyPk)
+	if !verified {
+		return nil, errors.New("invalid data signature")
+	}
 
-	return verified, nil
+	return payload, nil
 }
 
-// verify the signed header of the set request
-func verifySignedHeader(header string, pk []byte) (bool, error) {
+// verify the signed header of a request, its timestamp should be within the allowed clock skew of the server time
+func verifySignedHeader(header string, pk []byte, skew time.Duration) (map[string]interface{}, error) {
 
 	// pk in bytes
 	verifyPk := [32]byte{}
@@ -37,25 +93,49 @@ func verifySignedHeader(header string, pk []byte) (bool, error) {
 
 	decodedHeader, err := base64.StdEncoding.DecodeString(header)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	decodedHeaderOut := []byte{}
 
 	verifiedSignedHeader, verified := sign.Open(decodedHeaderOut, decodedHeader, &verifyPk)
+	if !verified {
+		return nil, errHeaderSignature
+	}
 
 	jsonHeader := map[string]interface{}{}
 	err = json.Unmarshal(verifiedSignedHeader, &jsonHeader)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	timestamp, ok := jsonHeader["timestamp"].(float64)
+	if !ok {
+		return nil, errors.New("header timestamp is missing")
 	}
 
-	milliseconds := time.Now().Unix()
-	diff := milliseconds - int64(jsonHeader["timestamp"].(float64))
+	diff := time.Since(time.Unix(int64(timestamp), 0))
+	if diff > skew || diff < -skew {
+		return nil, fmt.Errorf("%w %v, %v", errClockSkew, skew, diff)
+	}
+
+	return jsonHeader, nil
+}
 
-	if diff > 5 || jsonHeader["intent"].(string) != "pkid.store" {
-		return false, fmt.Errorf("timestamp difference exceeded 5 seconds, %v", diff)
+// verify the claims of a signed header, claims are the fields the header should hold (e.g. intent, project, key)
+func verifyHeaderClaims(header map[string]interface{}, claims map[string]string) error {
+	for field, expected := range claims {
+		value, ok := header[field].(string)
+		if !ok || value != expected {
+			return fmt.Errorf("header %s is invalid, expected %q", field, expected)
+		}
 	}
 
-	return verified, nil
+	return nil
+}
+
+// hash the request body for the body_hash claim of signed headers
+func hashBody(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
 }
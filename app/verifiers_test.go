@@ -3,6 +3,7 @@ package app
 
 import (
 	"testing"
+	"time"
 
 	"github.com/rawdaGastan/pkid/client"
 )
@@ -26,7 +27,7 @@ func TestVerifiers(t *testing.T) {
 	t.Run("test_wrong_encoding_header", func(t *testing.T) {
 		encoded := "XXXXXaGVsbG8="
 
-		_, err := verifySignedHeader(encoded, publicKey)
+		_, err := verifySignedHeader(encoded, publicKey, 5*time.Second)
 		if err == nil {
 			t.Error("decoding should fail")
 		}
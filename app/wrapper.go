@@ -2,11 +2,15 @@
 package app
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
+	"github.com/rawdaGastan/pkid/middlewares"
+	"github.com/rawdaGastan/pkid/pkg"
 	"github.com/rs/zerolog/log"
 )
 
@@ -15,6 +19,16 @@ type Response interface {
 	Status() int
 	Err() error
 
+	// code getter, the machine readable code of the error
+	Code() string
+	// code setter
+	WithCode(code string) Response
+
+	// details getter, the machine readable details of the error (e.g. the exceeded limit)
+	Details() map[string]interface{}
+	// details setter, the given details are added to the current ones
+	WithDetails(details map[string]interface{}) Response
+
 	// header getter
 	Header() http.Header
 	// header setter
@@ -27,6 +41,17 @@ type ResponseMsg struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
+// ErrorMsg is the body of error responses
+type ErrorMsg struct {
+	// Code is the stable machine readable code of the error, see the codes of pkg
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	// Err is the message, it is deprecated and kept for older clients
+	Err string `json:"err"`
+}
+
 // Handler interface
 type Handler func(r *http.Request) (interface{}, Response)
 
@@ -42,10 +67,8 @@ func WrapFunc(a Handler) http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "application/json")
 
-		if result == nil {
-			w.WriteHeader(http.StatusOK)
-		} else {
-
+		status := http.StatusOK
+		if result != nil {
 			h := result.Header()
 			for k := range h {
 				for _, v := range h.Values(k) {
@@ -53,26 +76,42 @@ func WrapFunc(a Handler) http.HandlerFunc {
 				}
 			}
 
-			w.WriteHeader(result.Status())
+			status = result.Status()
 			if err := result.Err(); err != nil {
-				object = struct {
-					Error string `json:"err"`
-				}{
-					Error: err.Error(),
+				object = ErrorMsg{
+					Code:      result.Code(),
+					Message:   err.Error(),
+					Details:   result.Details(),
+					RequestID: middlewares.RequestID(r.Context()),
+					Err:       err.Error(),
 				}
 			}
 		}
 
-		if err := json.NewEncoder(w).Encode(object); err != nil {
-			log.Error().Err(err).Msg("failed to encode return object")
+		// no content and not modified responses have no body
+		if status == http.StatusNoContent || status == http.StatusNotModified {
+			w.WriteHeader(status)
+			return
 		}
+
+		// the body is encoded first so its length is sent
+		var body bytes.Buffer
+		if err := json.NewEncoder(&body).Encode(object); err != nil {
+			log.Ctx(r.Context()).Error().Err(err).Msg("failed to encode return object")
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+		w.WriteHeader(status)
+		_, _ = w.Write(body.Bytes())
 	}
 }
 
 type genericResponse struct {
-	status int
-	err    error
-	header http.Header
+	status  int
+	err     error
+	code    string
+	details map[string]interface{}
+	header  http.Header
 }
 
 func (r genericResponse) Status() int {
@@ -83,6 +122,32 @@ func (r genericResponse) Err() error {
 	return r.err
 }
 
+func (r genericResponse) Code() string {
+	return r.code
+}
+
+func (r genericResponse) WithCode(code string) Response {
+	r.code = code
+	return r
+}
+
+func (r genericResponse) Details() map[string]interface{} {
+	return r.details
+}
+
+func (r genericResponse) WithDetails(details map[string]interface{}) Response {
+	merged := make(map[string]interface{}, len(r.details)+len(details))
+	for k, v := range r.details {
+		merged[k] = v
+	}
+	for k, v := range details {
+		merged[k] = v
+	}
+
+	r.details = merged
+	return r
+}
+
 func (r genericResponse) Header() http.Header {
 	if r.header == nil {
 		r.header = http.Header{}
@@ -114,6 +179,11 @@ func Deleted() Response {
 	return genericResponse{status: http.StatusNoContent}
 }
 
+// NotModified return a not modified response, its body is not sent
+func NotModified() Response {
+	return genericResponse{status: http.StatusNotModified}
+}
+
 // Error generic error response
 func Error(err error, code ...int) Response {
 	status := http.StatusInternalServerError
@@ -125,7 +195,31 @@ func Error(err error, code ...int) Response {
 		err = fmt.Errorf("no message")
 	}
 
-	return genericResponse{status: status, err: err}
+	return genericResponse{status: status, err: err, code: defaultCode(status)}
+}
+
+// defaultCode gets the code of the errors of the given status that have no more specific code
+func defaultCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return pkg.CodeBadRequest
+	case http.StatusUnauthorized:
+		return pkg.CodeHeaderInvalid
+	case http.StatusNotFound:
+		return pkg.CodeNotFound
+	case http.StatusPreconditionFailed:
+		return pkg.CodeVersionConflict
+	case http.StatusRequestEntityTooLarge:
+		return pkg.CodeBodyTooLarge
+	case http.StatusTooManyRequests:
+		return pkg.CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return pkg.CodeNotReady
+	case http.StatusGatewayTimeout:
+		return pkg.CodeDatabaseTimeout
+	default:
+		return pkg.CodeInternal
+	}
 }
 
 // BadRequest result
@@ -147,3 +241,28 @@ func NotFound(err error) Response {
 func UnAuthorized(err error) Response {
 	return Error(err, http.StatusUnauthorized)
 }
+
+// PreconditionFailed response
+func PreconditionFailed(err error) Response {
+	return Error(err, http.StatusPreconditionFailed)
+}
+
+// ServiceUnavailable response
+func ServiceUnavailable(err error) Response {
+	return Error(err, http.StatusServiceUnavailable)
+}
+
+// GatewayTimeout response
+func GatewayTimeout(err error) Response {
+	return Error(err, http.StatusGatewayTimeout)
+}
+
+// PayloadTooLarge response
+func PayloadTooLarge(err error) Response {
+	return Error(err, http.StatusRequestEntityTooLarge)
+}
+
+// TooManyRequests response
+func TooManyRequests(err error) Response {
+	return Error(err, http.StatusTooManyRequests)
+}
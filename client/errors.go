@@ -0,0 +1,144 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rawdaGastan/pkid/pkg"
+)
+
+// errors of the pkid api, they can be checked with errors.Is on the errors of the client
+var (
+	// ErrNotFound is returned when the key or revision doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is returned when the signed Authorization header of a request is rejected
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrSignatureInvalid is returned when a signed header or payload is not signed by the key pair of the client
+	ErrSignatureInvalid = errors.New("invalid signature")
+	// ErrHeaderExpired is returned when the clock of the client is out of the clock skew allowed by the server
+	ErrHeaderExpired = errors.New("authorization header is expired")
+	// ErrInvalidRequest is returned when the request is malformed, e.g. a reserved project name
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrBodyTooLarge is returned when the signed value is larger than the max body size of the server
+	ErrBodyTooLarge = errors.New("body is too large")
+	// ErrQuotaExceeded is returned when a write exceeds one of the storage quotas of the public key
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrRateLimited is returned when the requests of the client exceed the rate limits of the server
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUnavailable is returned when the server can't serve the request now, e.g. a database timeout
+	ErrUnavailable = errors.New("server unavailable")
+)
+
+// codeErrors are the sentinel errors of each code of the api
+var codeErrors = map[string][]error{
+	pkg.CodeBadRequest:               {ErrInvalidRequest},
+	pkg.CodeInvalidName:              {ErrInvalidRequest},
+	pkg.CodeInvalidPublicKey:         {ErrInvalidRequest},
+	pkg.CodePayloadInvalid:           {ErrInvalidRequest},
+	pkg.CodeDataVersionUnsupported:   {ErrInvalidRequest},
+	pkg.CodeBatchTooLarge:            {ErrInvalidRequest},
+	pkg.CodeAuthorizationMissing:     {ErrUnauthorized},
+	pkg.CodeSignatureInvalid:         {ErrUnauthorized, ErrSignatureInvalid},
+	pkg.CodeHeaderInvalid:            {ErrUnauthorized},
+	pkg.CodeHeaderExpired:            {ErrUnauthorized, ErrHeaderExpired},
+	pkg.CodeHeaderVersionUnsupported: {ErrUnauthorized},
+	pkg.CodeHeaderReplayed:           {ErrUnauthorized},
+	pkg.CodeNotFound:                 {ErrNotFound},
+	pkg.CodeVersionConflict:          {ErrVersionConflict},
+	pkg.CodeBodyTooLarge:             {ErrBodyTooLarge},
+	pkg.CodeProjectsQuotaExceeded:    {ErrQuotaExceeded},
+	pkg.CodeKeysQuotaExceeded:        {ErrQuotaExceeded},
+	pkg.CodeBytesQuotaExceeded:       {ErrQuotaExceeded},
+	pkg.CodeRateLimited:              {ErrRateLimited},
+	pkg.CodeDatabaseTimeout:          {ErrUnavailable},
+	pkg.CodeRequestCanceled:          {ErrUnavailable},
+	pkg.CodeNotReady:                 {ErrUnavailable},
+}
+
+// APIError is an error response of the pkid server
+type APIError struct {
+	// StatusCode is the http status of the response
+	StatusCode int
+	// Code is the machine readable code of the error, see the codes of pkg
+	Code    string
+	Message string
+	// Details are the machine readable details of the error, e.g. the exceeded limit
+	Details   map[string]interface{}
+	RequestID string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("request failed with status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is matches the sentinel errors of the code of the error, e.g. errors.Is(err, ErrQuotaExceeded)
+func (e *APIError) Is(target error) bool {
+	for _, err := range codeErrors[e.Code] {
+		if err == target {
+			return true
+		}
+	}
+	return false
+}
+
+// newAPIError parses the body of an error response, responses of older servers only have an err message
+func newAPIError(response *http.Response, body []byte) *APIError {
+	var msg struct {
+		Code      string                 `json:"code"`
+		Message   string                 `json:"message"`
+		Details   map[string]interface{} `json:"details"`
+		RequestID string                 `json:"request_id"`
+		Err       string                 `json:"err"`
+	}
+	_ = json.Unmarshal(body, &msg)
+
+	if msg.Message == "" {
+		msg.Message = msg.Err
+	}
+	if msg.Message == "" {
+		msg.Message = http.StatusText(response.StatusCode)
+	}
+
+	if msg.Code == "" && response.StatusCode == http.StatusPreconditionFailed {
+		msg.Code = pkg.CodeVersionConflict
+	}
+
+	return &APIError{
+		StatusCode: response.StatusCode,
+		Code:       msg.Code,
+		Message:    msg.Message,
+		Details:    msg.Details,
+		RequestID:  msg.RequestID,
+	}
+}
+
+// readResponse reads the body of a response into out if it is given, error responses are returned as *APIError
+func readResponse(response *http.Response, out interface{}) error {
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("read response body failed with error: %w", err)
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return newAPIError(response, body)
+	}
+
+	// successful deletes are answered with no content
+	if out == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("unmarshal response body failed with error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"errors"
+	"time"
+)
+
+// ListOptions filters and pages the listed keys of a project
+type ListOptions struct {
+	// Prefix only lists the keys that start with it
+	Prefix string
+	// Limit is the max number of keys of a page, the server has a default limit if it is 0
+	Limit int
+	// Cursor is the NextCursor of the previous page, it is empty for the first page
+	Cursor string
+	// WithMetadata lists the metadata of the keys too
+	WithMetadata bool
+}
+
+// KeyPage is a page of the keys of a project
+type KeyPage struct {
+	Keys []string
+	// Metadata is the metadata of the keys in the same order, it is only listed with ListOptions.WithMetadata
+	Metadata []KeyMetadata
+	// NextCursor lists the next page, it is empty for the last page
+	NextCursor string
+}
+
+// KeyMetadata is the version, write times, expiry and size in bytes of the stored value of a key,
+// the write times are zero if the server doesn't know them and the expiry is zero if the key never expires
+type KeyMetadata struct {
+	Key       string
+	Version   int64
+	Size      int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// keyMetadataMsg is the metadata of a key in a response
+type keyMetadataMsg struct {
+	Key       string    `json:"key"`
+	Revision  int64     `json:"revision"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// metadata converts the metadata of a response
+func (m keyMetadataMsg) metadata() KeyMetadata {
+	return KeyMetadata{
+		Key:       m.Key,
+		Version:   m.Revision,
+		Size:      m.Size,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+		ExpiresAt: m.ExpiresAt,
+	}
+}
+
+// KeyIterator iterates over the keys of a project, it lists the next page when the keys of a page are done
+//
+//	it := pkidClient.Keys("pkid", client.ListOptions{Prefix: "user/"})
+//	for it.Next() {
+//		key := it.Key()
+//	}
+//	err := it.Err()
+type KeyIterator struct {
+	pc      *PkidClient
+	project string
+	opts    ListOptions
+	keys    []string
+	index   int
+	started bool
+	err     error
+}
+
+// Keys creates an iterator over the keys of a project that starts from the page of the given options
+func (pc *PkidClient) Keys(project string, opts ListOptions) *KeyIterator {
+	return &KeyIterator{pc: pc, project: project, opts: opts, index: -1}
+}
+
+// Next moves to the next key, it returns false when there are no more keys or listing a page failed
+func (it *KeyIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.index++
+	for it.index >= len(it.keys) {
+		if it.started && it.opts.Cursor == "" {
+			return false
+		}
+
+		page, err := it.pc.ListPage(it.project, it.opts)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		// a cursor that doesn't move would list the same page forever
+		if page.NextCursor != "" && page.NextCursor == it.opts.Cursor {
+			it.err = errors.New("list cursor is not moving to the next page")
+			return false
+		}
+
+		it.started = true
+		it.keys = page.Keys
+		it.index = 0
+		it.opts.Cursor = page.NextCursor
+	}
+
+	return true
+}
+
+// Key gets the current key
+func (it *KeyIterator) Key() string {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return ""
+	}
+	return it.keys[it.index]
+}
+
+// Err gets the error of listing a page, it should be checked when Next returns false
+func (it *KeyIterator) Err() error {
+	return it.err
+}
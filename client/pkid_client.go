@@ -3,17 +3,29 @@ package client
 import (
 	"bytes"
 	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rawdaGastan/pkid/pkg"
 )
 
+// headerVersion is the version of the signed Authorization headers
+const headerVersion = 2
+
 // PkidClient a struct for client requirements
 type PkidClient struct {
 	client     http.Client
@@ -45,6 +57,45 @@ func NewPkidClientWithHTTPClient(privateKey []byte, publicKey []byte, url string
 	}
 }
 
+// NewPkidClientWithTLSConfig creates a new instance from the pkid client that uses the given tls configurations,
+// for servers with a private certificate authority or that require client certificates
+func NewPkidClientWithTLSConfig(privateKey []byte, publicKey []byte, url string, timeout time.Duration, tlsConfig *tls.Config) PkidClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return NewPkidClientWithHTTPClient(privateKey, publicKey, url, &http.Client{Timeout: timeout, Transport: transport})
+}
+
+// NewTLSConfig creates tls configurations that trust the certificate authorities of the given PEM bundle,
+// the system authorities are trusted if caFile is empty. The client certificate and its key are optional,
+// they are needed if the server verifies client certificates
+func NewTLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		bundle, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca bundle failed with error: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed with error: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
 // GenerateKeyPair generates a private key and public key for the client
 func GenerateKeyPair() (privateKey []byte, publicKey []byte, err error) {
 	publicKey, privateKey, err = ed25519.GenerateKey(nil)
@@ -72,39 +123,52 @@ func GenerateKeyPairUsingSeed(seed string) (privateKey []byte, publicKey []byte,
 	return
 }
 
+// ErrVersionConflict is returned when the version of a conditional set doesn't match the current version of the key
+var ErrVersionConflict = errors.New("version conflict")
+
 // Set sets a new value for a key inside a project
 func (pc *PkidClient) Set(project string, key string, value string, willEncrypt bool) (err error) {
+	return pc.set(project, key, value, willEncrypt, 0, nil)
+}
 
-	if willEncrypt {
-		value, err = pkg.Encrypt(value, pc.publicKey)
-		if err != nil {
-			return err
-		}
+// SetWithTTL sets a new value for a key inside a project that expires after the given time to live,
+// it is rounded up to whole seconds. An expired key is not found and it is deleted by the server later
+func (pc *PkidClient) SetWithTTL(project string, key string, value string, willEncrypt bool, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl should be positive")
 	}
 
-	header := map[string]interface{}{
-		"intent":    "pkid.store",
-		"timestamp": time.Now().Unix(),
-	}
+	return pc.set(project, key, value, willEncrypt, ttl, nil)
+}
 
-	payload := map[string]interface{}{
-		"is_encrypted": willEncrypt,
-		"payload":      value,
-		"data_version": 1,
+// SetIfVersion sets a new value for a key inside a project only if the current version of the key is the given version,
+// version 0 means the key should not exist yet. It returns an error that is ErrVersionConflict if the key has another version
+func (pc *PkidClient) SetIfVersion(project string, key string, value string, willEncrypt bool, version int64) error {
+	preconditions := http.Header{}
+	if version == 0 {
+		preconditions.Set("If-None-Match", "*")
+	} else {
+		preconditions.Set("If-Match", strconv.Quote(strconv.FormatInt(version, 10)))
 	}
 
-	signedBody, err := pkg.SignEncode(payload, pc.privateKey)
-	if err != nil {
-		return fmt.Errorf("error sign body: %w", err)
-	}
+	return pc.set(project, key, value, willEncrypt, 0, preconditions)
+}
 
-	signedHeader, err := pkg.SignEncode(header, pc.privateKey)
+// set sends the set request of a value with the given time to live and precondition headers, 0 ttl never expires
+func (pc *PkidClient) set(project string, key string, value string, willEncrypt bool, ttl time.Duration, preconditions http.Header) (err error) {
+
+	signedBody, err := pc.signPayload(value, willEncrypt, ttl)
 	if err != nil {
-		return fmt.Errorf("error sign header: %w", err)
+		return err
 	}
 
 	// set request
 	jsonBody := []byte(signedBody)
+
+	signedHeader, err := pc.signHeader(http.MethodPost, "pkid.store", project, key, jsonBody)
+	if err != nil {
+		return err
+	}
 	bodyReader := bytes.NewReader(jsonBody)
 
 	requestURL := fmt.Sprintf("%v/%v/%v/%v", pc.serverURL, hex.EncodeToString(pc.publicKey), project, key)
@@ -113,6 +177,9 @@ func (pc *PkidClient) Set(project string, key string, value string, willEncrypt
 		return fmt.Errorf("set request failed with error: %w", err)
 	}
 
+	for k := range preconditions {
+		request.Header.Set(k, preconditions.Get(k))
+	}
 	request.Header.Set("Authorization", signedHeader)
 	request.Header.Set("Content-Type", "application/json")
 
@@ -121,125 +188,351 @@ func (pc *PkidClient) Set(project string, key string, value string, willEncrypt
 		return fmt.Errorf("set response failed with error: %w", err)
 	}
 
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
+	var data map[string]interface{}
+	return readResponse(response, &data)
+}
+
+// SetMany sets new values for several keys inside a project, all of them are set or none of them
+func (pc *PkidClient) SetMany(project string, values map[string]string, willEncrypt bool) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	documents := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		signedBody, err := pc.signPayload(values[key], willEncrypt, 0)
+		if err != nil {
+			return err
+		}
+
+		documents = append(documents, map[string]string{"key": key, "data": signedBody})
+	}
+
+	jsonBody, err := json.Marshal(map[string]interface{}{"documents": documents})
 	if err != nil {
-		return fmt.Errorf("read response body failed: %w", err)
+		return fmt.Errorf("marshal batch body failed with error: %w", err)
 	}
 
-	var data map[string]interface{}
-	err = json.Unmarshal(body, &data)
+	signedHeader, err := pc.signHeader(http.MethodPost, "pkid.batch", project, "", jsonBody)
+	if err != nil {
+		return err
+	}
 
+	requestURL := fmt.Sprintf("%v/%v/%v/_batch", pc.serverURL, hex.EncodeToString(pc.publicKey), project)
+	request, err := http.NewRequest(http.MethodPost, requestURL, bytes.NewReader(jsonBody))
 	if err != nil {
-		return fmt.Errorf("unmarshal response body failed: %w", err)
+		return fmt.Errorf("set request failed with error: %w", err)
 	}
 
-	return nil
+	request.Header.Set("Authorization", signedHeader)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := pc.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("set response failed with error: %w", err)
+	}
+
+	var data map[string]interface{}
+	return readResponse(response, &data)
 }
 
 // Get gets a value for a key inside a project
 func (pc *PkidClient) Get(project string, key string) (string, error) {
+	value, _, err := pc.GetWithVersion(project, key)
+	return value, err
+}
+
+// GetWithVersion gets a value for a key inside a project with the current version of the key,
+// the version can be used with SetIfVersion
+func (pc *PkidClient) GetWithVersion(project string, key string) (string, int64, error) {
+	value, metadata, err := pc.GetWithMetadata(project, key)
+	return value, metadata.Version, err
+}
+
+// GetWithMetadata gets a value for a key inside a project with the current version, write times, expiry and size of the key
+func (pc *PkidClient) GetWithMetadata(project string, key string) (string, KeyMetadata, error) {
 
 	requestURL := fmt.Sprintf("%v/%v/%v/%v", pc.serverURL, hex.EncodeToString(pc.publicKey), project, key)
 	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("get request failed with error: %w", err)
+		return "", KeyMetadata{}, fmt.Errorf("get request failed with error: %w", err)
 	}
 
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := pc.client.Do(request)
 	if err != nil {
-		return "", fmt.Errorf("get response failed with error: %w", err)
+		return "", KeyMetadata{}, fmt.Errorf("get response failed with error: %w", err)
+	}
+
+	var data struct {
+		Data string `json:"data"`
+		keyMetadataMsg
+	}
+	if err := readResponse(response, &data); err != nil {
+		return "", KeyMetadata{}, err
+	}
+
+	version, err := parseVersion(response.Header.Get("ETag"))
+	if err != nil {
+		return "", KeyMetadata{}, err
 	}
 
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
+	value, err := pc.openPayload(data.Data)
 	if err != nil {
-		return "", fmt.Errorf("read response body failed with error: %w", err)
+		return "", KeyMetadata{}, err
 	}
 
-	var data map[string]string
-	err = json.Unmarshal(body, &data)
+	metadata := data.metadata()
+	metadata.Key = key
+	metadata.Version = version
+	return value, metadata, nil
+}
+
+// GetMany gets the values of several keys inside a project, keys that don't exist are left out of the values
+func (pc *PkidClient) GetMany(project string, keys []string) (map[string]string, error) {
 
+	query := url.Values{"key": keys}
+	requestURL := fmt.Sprintf("%v/%v/%v/_batch?%v", pc.serverURL, hex.EncodeToString(pc.publicKey), project, query.Encode())
+	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("unmarshal response body failed with error: %w", err)
+		return nil, fmt.Errorf("get request failed with error: %w", err)
 	}
 
-	signedPayload := data["data"]
+	request.Header.Set("Content-Type", "application/json")
 
-	payload, err := pkg.VerifySignedData(signedPayload, pc.publicKey)
+	response, err := pc.client.Do(request)
 	if err != nil {
-		return "", fmt.Errorf("verifying data failed with error: %w", err)
+		return nil, fmt.Errorf("get response failed with error: %w", err)
 	}
 
-	var jsonPayload map[string]interface{}
-	err = json.Unmarshal(payload, &jsonPayload)
+	var data struct {
+		Data []struct {
+			Key  string `json:"key"`
+			Data string `json:"data"`
+		} `json:"data"`
+	}
+	if err := readResponse(response, &data); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(data.Data))
+	for _, doc := range data.Data {
+		value, err := pc.openPayload(doc.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		values[doc.Key] = value
+	}
+
+	return values, nil
+}
+
+// Revision is a kept previous value of a key
+type Revision struct {
+	Version int64
+	Value   string
+}
+
+// History gets the kept revisions of a key inside a project, the latest version first
+func (pc *PkidClient) History(project string, key string) ([]Revision, error) {
 
+	requestURL := fmt.Sprintf("%v/%v/%v/%v/history", pc.serverURL, hex.EncodeToString(pc.publicKey), project, key)
+	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("unmarshal payload failed with error: %w", err)
+		return nil, fmt.Errorf("history request failed with error: %w", err)
 	}
 
-	isEncrypted := jsonPayload["is_encrypted"].(bool)
-	value := jsonPayload["payload"].(string)
+	request.Header.Set("Content-Type", "application/json")
 
-	if isEncrypted {
-		value, err = pkg.Decrypt(value, pc.publicKey, pc.privateKey)
+	response, err := pc.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("history response failed with error: %w", err)
+	}
+
+	var data struct {
+		Data []struct {
+			Revision int64  `json:"revision"`
+			Data     string `json:"data"`
+		} `json:"data"`
+	}
+	if err := readResponse(response, &data); err != nil {
+		return nil, err
+	}
+
+	revisions := make([]Revision, 0, len(data.Data))
+	for _, revision := range data.Data {
+		value, err := pc.openPayload(revision.Data)
 		if err != nil {
-			return "", fmt.Errorf("decrypting value failed with error: %w", err)
+			return nil, err
 		}
+
+		revisions = append(revisions, Revision{Version: revision.Revision, Value: value})
 	}
 
-	return value, nil
+	return revisions, nil
+}
+
+// Restore sets the value of a key inside a project back to the value of one of its kept versions
+func (pc *PkidClient) Restore(project string, key string, version int64) error {
+	jsonBody, err := json.Marshal(map[string]int64{"revision": version})
+	if err != nil {
+		return fmt.Errorf("marshal restore body failed with error: %w", err)
+	}
+
+	signedHeader, err := pc.signHeader(http.MethodPost, "pkid.restore", project, key, jsonBody)
+	if err != nil {
+		return err
+	}
+
+	requestURL := fmt.Sprintf("%v/%v/%v/%v/restore", pc.serverURL, hex.EncodeToString(pc.publicKey), project, key)
+	request, err := http.NewRequest(http.MethodPost, requestURL, bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("restore request failed with error: %w", err)
+	}
+
+	request.Header.Set("Authorization", signedHeader)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := pc.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("restore response failed with error: %w", err)
+	}
+
+	var data map[string]interface{}
+	return readResponse(response, &data)
 }
 
-// List lists all keys for a project
+// List lists all keys for a project ordered by key, it follows all pages of the keys
 func (pc *PkidClient) List(project string) ([]string, error) {
+	keys := []string{}
 
-	requestURL := fmt.Sprintf("%v/%v/%v", pc.serverURL, hex.EncodeToString(pc.publicKey), project)
+	it := pc.Keys(project, ListOptions{})
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+
+	if err := it.Err(); err != nil {
+		return []string{}, err
+	}
+
+	return keys, nil
+}
+
+// ListPage lists a page of the keys of a project ordered by key, the next page is listed with the NextCursor of the page
+func (pc *PkidClient) ListPage(project string, opts ListOptions) (KeyPage, error) {
+
+	query := url.Values{}
+	if opts.Prefix != "" {
+		query.Set("prefix", opts.Prefix)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	if opts.WithMetadata {
+		query.Set("metadata", "true")
+	}
+
+	requestURL := fmt.Sprintf("%v/%v/%v?%v", pc.serverURL, hex.EncodeToString(pc.publicKey), project, query.Encode())
 	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
 	if err != nil {
-		return []string{}, fmt.Errorf("get request failed with error: %w", err)
+		return KeyPage{}, fmt.Errorf("get request failed with error: %w", err)
 	}
 
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := pc.client.Do(request)
 	if err != nil {
-		return []string{}, fmt.Errorf("get response failed with error: %w", err)
+		return KeyPage{}, fmt.Errorf("get response failed with error: %w", err)
 	}
 
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
+	var data struct {
+		Data       []string         `json:"data"`
+		Metadata   []keyMetadataMsg `json:"metadata"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	if err := readResponse(response, &data); err != nil {
+		return KeyPage{}, err
+	}
+
+	if data.Data == nil {
+		data.Data = []string{}
+	}
+
+	page := KeyPage{Keys: data.Data, NextCursor: data.NextCursor}
+	if opts.WithMetadata {
+		page.Metadata = make([]KeyMetadata, 0, len(data.Metadata))
+		for _, m := range data.Metadata {
+			page.Metadata = append(page.Metadata, m.metadata())
+		}
+	}
+
+	return page, nil
+}
+
+// Project is a project of the public key with the number of its keys and their size in bytes
+type Project struct {
+	Name  string
+	Keys  int
+	Bytes int64
+}
+
+// ListProjects lists the projects of the public key ordered by name
+func (pc *PkidClient) ListProjects() ([]Project, error) {
+
+	requestURL := fmt.Sprintf("%v/%v", pc.serverURL, hex.EncodeToString(pc.publicKey))
+	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
 	if err != nil {
-		return []string{}, fmt.Errorf("read response body failed with error: %w", err)
+		return nil, fmt.Errorf("list projects request failed with error: %w", err)
 	}
 
-	var data map[string]interface{}
-	err = json.Unmarshal(body, &data)
+	request.Header.Set("Content-Type", "application/json")
 
+	response, err := pc.client.Do(request)
 	if err != nil {
-		return []string{}, fmt.Errorf("unmarshal response body failed with error: %w", err)
+		return nil, fmt.Errorf("list projects response failed with error: %w", err)
 	}
 
-	interfaceKeys := data["data"].([]interface{})
-	keys := make([]string, len(interfaceKeys))
-	for i, v := range interfaceKeys {
-		keys[i] = v.(string)
+	var data struct {
+		Data []struct {
+			Project string `json:"project"`
+			Keys    int    `json:"keys"`
+			Bytes   int64  `json:"bytes"`
+		} `json:"data"`
+	}
+	if err := readResponse(response, &data); err != nil {
+		return nil, err
 	}
 
-	return keys, nil
+	projects := make([]Project, 0, len(data.Data))
+	for _, project := range data.Data {
+		projects = append(projects, Project{Name: project.Project, Keys: project.Keys, Bytes: project.Bytes})
+	}
+
+	return projects, nil
 }
 
 // DeleteProject deletes a key with its value inside a project
 func (pc *PkidClient) DeleteProject(project string) error {
 
+	signedHeader, err := pc.signHeader(http.MethodDelete, "pkid.delete_project", project, "", nil)
+	if err != nil {
+		return err
+	}
+
 	requestURL := fmt.Sprintf("%v/%v/%v", pc.serverURL, hex.EncodeToString(pc.publicKey), project)
 	request, err := http.NewRequest(http.MethodDelete, requestURL, nil)
 	if err != nil {
 		return fmt.Errorf("delete request failed with error: %w", err)
 	}
 
+	request.Header.Set("Authorization", signedHeader)
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := pc.client.Do(request)
@@ -247,31 +540,25 @@ func (pc *PkidClient) DeleteProject(project string) error {
 		return fmt.Errorf("delete response failed with error: %w", err)
 	}
 
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return fmt.Errorf("read response body failed with error: %w", err)
-	}
-
 	var data map[string]interface{}
-	err = json.Unmarshal(body, &data)
-
-	if err != nil {
-		return fmt.Errorf("unmarshal response body failed with error: %w", err)
-	}
-
-	return nil
+	return readResponse(response, &data)
 }
 
 // Delete deletes a key with its value inside a project
 func (pc *PkidClient) Delete(project string, key string) error {
 
+	signedHeader, err := pc.signHeader(http.MethodDelete, "pkid.delete", project, key, nil)
+	if err != nil {
+		return err
+	}
+
 	requestURL := fmt.Sprintf("%v/%v/%v/%v", pc.serverURL, hex.EncodeToString(pc.publicKey), project, key)
 	request, err := http.NewRequest(http.MethodDelete, requestURL, nil)
 	if err != nil {
 		return fmt.Errorf("delete request failed with error: %w", err)
 	}
 
+	request.Header.Set("Authorization", signedHeader)
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := pc.client.Do(request)
@@ -279,18 +566,112 @@ func (pc *PkidClient) Delete(project string, key string) error {
 		return fmt.Errorf("delete response failed with error: %w", err)
 	}
 
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
+	var data map[string]interface{}
+	return readResponse(response, &data)
+}
+
+// signHeader signs the Authorization header of a request, the header is bound to the request method, project, key
+// and body hash, and it holds the current timestamp and a random nonce so it can't be replayed
+func (pc *PkidClient) signHeader(method string, intent string, project string, key string, body []byte) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error generate nonce: %w", err)
+	}
+
+	bodyHash := sha256.Sum256(body)
+
+	header := map[string]interface{}{
+		"version":   headerVersion,
+		"intent":    intent,
+		"timestamp": time.Now().Unix(),
+		"nonce":     hex.EncodeToString(nonce),
+		"method":    method,
+		"project":   project,
+		"key":       key,
+		"body_hash": hex.EncodeToString(bodyHash[:]),
+	}
+
+	signedHeader, err := pkg.SignEncode(header, pc.privateKey)
 	if err != nil {
-		return fmt.Errorf("read response body failed with error: %w", err)
+		return "", fmt.Errorf("error sign header: %w", err)
 	}
 
-	var data map[string]interface{}
-	err = json.Unmarshal(body, &data)
+	return signedHeader, nil
+}
+
+// parseVersion parses the version of a key from its ETag, it is 0 if there is no ETag
+func parseVersion(etag string) (int64, error) {
+	if etag == "" {
+		return 0, nil
+	}
+
+	unquoted, err := strconv.Unquote(strings.TrimPrefix(etag, "W/"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid ETag %s: %w", etag, err)
+	}
+
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ETag %s: %w", etag, err)
+	}
+
+	return version, nil
+}
+
+// signPayload signs the payload envelope of a value with its time to live if it isn't 0,
+// the value is encrypted first if willEncrypt is true
+func (pc *PkidClient) signPayload(value string, willEncrypt bool, ttl time.Duration) (string, error) {
+	if willEncrypt {
+		var err error
+		value, err = pkg.Encrypt(value, pc.publicKey)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	payload := map[string]interface{}{
+		"is_encrypted": willEncrypt,
+		"payload":      value,
+		"data_version": 1,
+	}
+	if ttl > 0 {
+		payload["ttl"] = int64((ttl + time.Second - 1) / time.Second)
+	}
+
+	signedBody, err := pkg.SignEncode(payload, pc.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("error sign body: %w", err)
+	}
+
+	return signedBody, nil
+}
+
+// openPayload verifies a signed payload and decrypts its value if it is encrypted
+func (pc *PkidClient) openPayload(signedPayload string) (string, error) {
+	payload, err := pkg.VerifySignedData(signedPayload, pc.publicKey)
+	if err != nil {
+		return "", fmt.Errorf("verifying data failed with error: %w", err)
+	}
+
+	var jsonPayload map[string]interface{}
+	err = json.Unmarshal(payload, &jsonPayload)
 
 	if err != nil {
-		return fmt.Errorf("unmarshal response body failed with error: %w", err)
+		return "", fmt.Errorf("unmarshal payload failed with error: %w", err)
+	}
+
+	isEncrypted, _ := jsonPayload["is_encrypted"].(bool)
+	value, ok := jsonPayload["payload"].(string)
+	if !ok {
+		return "", errors.New("payload has no value")
 	}
 
-	return nil
+	if isEncrypted {
+		value, err = pkg.Decrypt(value, pc.publicKey, pc.privateKey)
+		if err != nil {
+			return "", fmt.Errorf("decrypting value failed with error: %w", err)
+		}
+	}
+
+	return value, nil
 }
@@ -1,10 +1,15 @@
 package client
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -80,6 +85,108 @@ func TestFakePkid(t *testing.T) {
 		}
 	})
 
+	t.Run("test_get_with_metadata_func", func(t *testing.T) {
+		signedBody, err := pkg.SignEncode(map[string]interface{}{
+			"is_encrypted": false,
+			"payload":      "value",
+			"data_version": 1,
+		}, privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		updatedAt := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"3"`)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"msg":        "data is got successfully",
+				"data":       signedBody,
+				"size":       len(signedBody),
+				"updated_at": updatedAt,
+			})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		value, metadata, err := c.GetWithMetadata("pkid", "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := KeyMetadata{Key: "key", Version: 3, Size: int64(len(signedBody)), UpdatedAt: updatedAt}
+		if value != "value" || !reflect.DeepEqual(metadata, want) {
+			t.Errorf("Unexpected metadata returned. Got %q %+v, want %+v", value, metadata, want)
+		}
+	})
+
+	t.Run("test_set_with_ttl_func", func(t *testing.T) {
+		var ttl int64
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			payload, err := pkg.VerifySignedData(string(body), publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var envelope struct {
+				TTL int64 `json:"ttl"`
+			}
+			if err := json.Unmarshal(payload, &envelope); err != nil {
+				t.Fatal(err)
+			}
+			ttl = envelope.TTL
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]string{"msg": "data is set successfully"})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		if err := c.SetWithTTL("pkid", "key", "value", false, 90*time.Second+time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+
+		if ttl != 91 {
+			t.Errorf("Unexpected ttl sent. Got %d, want 91", ttl)
+		}
+
+		if err := c.SetWithTTL("pkid", "key", "value", false, 0); err == nil {
+			t.Errorf("Set with 0 ttl should fail")
+		}
+	})
+
+	t.Run("test_list_page_metadata_func", func(t *testing.T) {
+		updatedAt := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("metadata") != "true" {
+				t.Errorf("Unexpected list query %s", r.URL.RawQuery)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"msg":  "data is listed successfully",
+				"data": []string{"key"},
+				"metadata": []map[string]interface{}{
+					{"key": "key", "revision": 2, "size": 10, "created_at": updatedAt, "updated_at": updatedAt},
+				},
+			})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		page, err := c.ListPage("pkid", ListOptions{WithMetadata: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []KeyMetadata{{Key: "key", Version: 2, Size: 10, CreatedAt: updatedAt, UpdatedAt: updatedAt}}
+		if !reflect.DeepEqual(page.Metadata, want) {
+			t.Errorf("Unexpected metadata returned. Got %+v, want %+v", page.Metadata, want)
+		}
+	})
+
 	t.Run("test_list_func", func(t *testing.T) {
 		want := []string{}
 		client := &http.Client{
@@ -455,6 +562,177 @@ func TestPkidClientFuncs(t *testing.T) {
 		}
 	})
 
+	t.Run("test_get_with_version_func", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"is_encrypted": false,
+			"payload":      "value",
+			"data_version": 1,
+		}
+		signedBody, err := pkg.SignEncode(payload, privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"3"`)
+			_ = json.NewEncoder(w).Encode(map[string]string{"msg": "data is got successfully", "data": signedBody})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		_, version, err := c.GetWithVersion("pkid", "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != 3 {
+			t.Errorf("Unexpected version returned. Got %d, want %d", version, 3)
+		}
+	})
+
+	t.Run("test_set_if_version_func", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-Match") != `"3"` {
+				t.Errorf("Unexpected If-Match header %q", r.Header.Get("If-Match"))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{"msg": "data is set successfully"})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		err := c.SetIfVersion("pkid", "key", "value", false, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("test_set_if_version_conflict_func", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") != "*" {
+				t.Errorf("Unexpected If-None-Match header %q", r.Header.Get("If-None-Match"))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"err": "document is modified by another request"})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		err := c.SetIfVersion("pkid", "key", "value", false, 0)
+		if !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("set should fail with a version conflict: %v", err)
+		}
+	})
+
+	t.Run("test_history_func", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"is_encrypted": false,
+			"payload":      "value",
+			"data_version": 1,
+		}
+		signedBody, err := pkg.SignEncode(payload, privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"msg":  "history is got successfully",
+				"data": []map[string]interface{}{{"revision": 2, "data": signedBody}},
+			})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		got, err := c.History("pkid", "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []Revision{{Version: 2, Value: "value"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Unexpected history returned. Got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("test_restore_func", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				t.Error("restore request should be signed")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"msg": "revision 2 is restored successfully"})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		err := c.Restore("pkid", "key", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("test_set_many_func", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/"+hex.EncodeToString(publicKey)+"/pkid/_batch" || r.Header.Get("Authorization") == "" {
+				t.Errorf("Unexpected batch request %s", r.URL.Path)
+			}
+
+			var body struct {
+				Documents []struct {
+					Key  string `json:"key"`
+					Data string `json:"data"`
+				} `json:"documents"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Error(err)
+			}
+			if len(body.Documents) != 2 || body.Documents[0].Key != "a" || body.Documents[1].Key != "b" {
+				t.Errorf("Unexpected batch documents %+v", body.Documents)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"msg": "data is set successfully"})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		err := c.SetMany("pkid", map[string]string{"b": "b", "a": "a"}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("test_get_many_func", func(t *testing.T) {
+		signedBody, err := pkg.SignEncode(map[string]interface{}{
+			"is_encrypted": false,
+			"payload":      "value",
+			"data_version": 1,
+		}, privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if keys := r.URL.Query()["key"]; !reflect.DeepEqual(keys, []string{"key", "missing"}) {
+				t.Errorf("Unexpected batch keys %v", keys)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"msg":  "data is got successfully",
+				"data": []map[string]interface{}{{"key": "key", "revision": 1, "data": signedBody}},
+			})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		got, err := c.GetMany("pkid", []string{"key", "missing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]string{"key": "value"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Unexpected values returned. Got %v, want %v", got, want)
+		}
+	})
+
 	t.Run("test_list_func", func(t *testing.T) {
 		want := []string{"key"}
 
@@ -473,8 +751,35 @@ func TestPkidClientFuncs(t *testing.T) {
 		}
 	})
 
+	t.Run("test_list_projects_func", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/"+hex.EncodeToString(publicKey) {
+				t.Errorf("Unexpected list projects path %s", r.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"msg":  "projects are listed successfully",
+				"data": []map[string]interface{}{{"project": "pkid", "keys": 2, "bytes": 10}},
+			})
+		}))
+
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		got, err := c.ListProjects()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []Project{{Name: "pkid", Keys: 2, Bytes: 10}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Unexpected projects returned. Got %v, want %v", got, want)
+		}
+	})
+
 	t.Run("test_delete_func", func(t *testing.T) {
 		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				t.Error("delete request should be signed")
+			}
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{"msg": "data is deleted successfully"})
 		}))
@@ -488,6 +793,9 @@ func TestPkidClientFuncs(t *testing.T) {
 
 	t.Run("test_delete_project_func", func(t *testing.T) {
 		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				t.Error("delete request should be signed")
+			}
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{"msg": "data is deleted successfully"})
 		}))
@@ -587,3 +895,245 @@ func TestPkidClient(t *testing.T) {
 		})
 	}
 }
+
+func TestPkidClientTLS(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Errorf("error generating keys: %q", err)
+	}
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"msg": "data is set successfully"}`))
+	}))
+	defer s.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("test_unknown_authority", func(t *testing.T) {
+		c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+		if err := c.Set("pkid", "key", "value", false); err == nil {
+			t.Error("set should fail, the server certificate is not trusted")
+		}
+	})
+
+	t.Run("test_ca_bundle", func(t *testing.T) {
+		tlsConfig, err := NewTLSConfig(caFile, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := NewPkidClientWithTLSConfig(privateKey, publicKey, s.URL, 5*time.Second, tlsConfig)
+		if err := c.Set("pkid", "key", "value", false); err != nil {
+			t.Errorf("set should be successful: %v", err)
+		}
+	})
+
+	t.Run("test_invalid_ca_bundle", func(t *testing.T) {
+		invalidFile := filepath.Join(t.TempDir(), "invalid.crt")
+		if err := os.WriteFile(invalidFile, []byte("invalid"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewTLSConfig(invalidFile, "", ""); err == nil {
+			t.Error("tls config should fail, no certificates in the bundle")
+		}
+	})
+
+	t.Run("test_missing_client_key", func(t *testing.T) {
+		if _, err := NewTLSConfig(caFile, caFile, ""); err == nil {
+			t.Error("tls config should fail, no client key")
+		}
+	})
+}
+
+func TestPkidClientErrors(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Errorf("error generating keys: %q", err)
+	}
+
+	serve := func(status int, body map[string]interface{}) PkidClient {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(body)
+		}))
+		t.Cleanup(s.Close)
+
+		return NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+	}
+
+	t.Run("test_quota_exceeded", func(t *testing.T) {
+		c := serve(http.StatusTooManyRequests, map[string]interface{}{
+			"code":       pkg.CodeKeysQuotaExceeded,
+			"message":    "project has reached the limit of 1 keys",
+			"details":    map[string]interface{}{"limit": 1},
+			"request_id": "id",
+		})
+
+		err := c.Set("pkid", "key", "value", false)
+		if !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("set should fail with an exceeded quota: %v", err)
+		}
+		if errors.Is(err, ErrBodyTooLarge) {
+			t.Error("an exceeded quota is not a too large body")
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("error should be an api error: %v", err)
+		}
+		if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Code != pkg.CodeKeysQuotaExceeded ||
+			apiErr.Details["limit"] != float64(1) || apiErr.RequestID != "id" {
+			t.Errorf("Unexpected api error %+v", apiErr)
+		}
+	})
+
+	t.Run("test_header_expired", func(t *testing.T) {
+		c := serve(http.StatusUnauthorized, map[string]interface{}{
+			"code":    pkg.CodeHeaderExpired,
+			"message": "timestamp is out of the allowed clock skew",
+		})
+
+		err := c.Delete("pkid", "key")
+		if !errors.Is(err, ErrHeaderExpired) || !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("delete should fail with an expired header: %v", err)
+		}
+	})
+
+	t.Run("test_not_found", func(t *testing.T) {
+		c := serve(http.StatusNotFound, map[string]interface{}{
+			"code":    pkg.CodeNotFound,
+			"message": "key is not found",
+		})
+
+		_, err := c.Get("pkid", "key")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("get should fail with not found: %v", err)
+		}
+	})
+
+	t.Run("test_unavailable", func(t *testing.T) {
+		c := serve(http.StatusGatewayTimeout, map[string]interface{}{
+			"code":    pkg.CodeDatabaseTimeout,
+			"message": "database timeout",
+		})
+
+		_, err := c.History("pkid", "key")
+		if !errors.Is(err, ErrUnavailable) {
+			t.Errorf("history should fail with an unavailable server: %v", err)
+		}
+	})
+
+	t.Run("test_legacy_error", func(t *testing.T) {
+		c := serve(http.StatusBadRequest, map[string]interface{}{"err": "invalid request"})
+
+		err := c.DeleteProject("pkid")
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("error should be an api error: %v", err)
+		}
+		if apiErr.Code != "" || apiErr.Message != "invalid request" {
+			t.Errorf("Unexpected api error %+v", apiErr)
+		}
+	})
+}
+
+func TestPkidClientKeys(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Errorf("error generating keys: %q", err)
+	}
+
+	pages := map[string]map[string]interface{}{
+		"":   {"msg": "data is listed successfully", "data": []string{"a", "b"}, "next_cursor": "c1"},
+		"c1": {"msg": "data is listed successfully", "data": []string{"c"}, "next_cursor": "c2"},
+		"c2": {"msg": "data is listed successfully", "data": []string{}},
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("prefix") != "p" && r.URL.Query().Has("prefix") {
+			t.Errorf("Unexpected prefix %q", r.URL.Query().Get("prefix"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pages[r.URL.Query().Get("cursor")])
+	}))
+	defer s.Close()
+
+	c := NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+
+	t.Run("test_keys_follow_cursors", func(t *testing.T) {
+		var got []string
+		it := c.Keys("pkid", ListOptions{Prefix: "p", Limit: 2})
+		for it.Next() {
+			got = append(got, it.Key())
+		}
+
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("Unexpected keys returned. Got %v", got)
+		}
+	})
+
+	t.Run("test_list_follows_cursors", func(t *testing.T) {
+		got, err := c.List("pkid")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("Unexpected keys returned. Got %v", got)
+		}
+	})
+
+	t.Run("test_list_page", func(t *testing.T) {
+		page, err := c.ListPage("pkid", ListOptions{Cursor: "c1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(page, KeyPage{Keys: []string{"c"}, NextCursor: "c2"}) {
+			t.Errorf("Unexpected page returned. Got %+v", page)
+		}
+	})
+
+	serve := func(body string) PkidClient {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(body))
+		}))
+		t.Cleanup(s.Close)
+
+		return NewPkidClient(privateKey, publicKey, s.URL, 5*time.Second)
+	}
+
+	t.Run("test_list_missing_data", func(t *testing.T) {
+		c := serve(`{"msg": "data is listed successfully"}`)
+		got, err := c.List("pkid")
+		if err != nil || len(got) != 0 {
+			t.Errorf("list without data should be empty, got %v: %v", got, err)
+		}
+	})
+
+	t.Run("test_list_malformed_data", func(t *testing.T) {
+		c := serve(`{"data": [1, 2]}`)
+		_, err := c.List("pkid")
+		if err == nil {
+			t.Error("list of malformed data should fail")
+		}
+	})
+
+	t.Run("test_list_stuck_cursor", func(t *testing.T) {
+		c := serve(`{"data": ["a"], "next_cursor": "c"}`)
+		_, err := c.List("pkid")
+		if err == nil {
+			t.Error("list with a cursor that doesn't move should fail")
+		}
+	})
+}
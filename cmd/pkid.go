@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/rawdaGastan/pkid/app"
+	"github.com/rawdaGastan/pkid/config"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -20,7 +21,26 @@ var rootCmd = &cobra.Command{
 			return fmt.Errorf("failed to parse config: %w", err)
 		}
 
-		app, err := app.NewApp(cmd.Context(), configFile)
+		logFormat, err := cmd.Flags().GetString("log-format")
+		if err != nil {
+			return fmt.Errorf("failed to parse log format: %w", err)
+		}
+
+		logLevel, err := cmd.Flags().GetString("log-level")
+		if err != nil {
+			return fmt.Errorf("failed to parse log level: %w", err)
+		}
+
+		conf, err := config.ReadConfFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to read config: %w", err)
+		}
+
+		if err := app.SetupLogger(conf, logFormat, logLevel); err != nil {
+			return fmt.Errorf("failed to set up logs: %w", err)
+		}
+
+		app, err := app.NewApp(cmd.Context(), conf)
 		if err != nil {
 			return fmt.Errorf("failed to create new app: %w", err)
 		}
@@ -50,4 +70,6 @@ func init() {
 	cobra.OnInitialize()
 
 	rootCmd.Flags().StringP("config", "c", "config.json", "Enter your configurations path")
+	rootCmd.Flags().String("log-format", "", "Log format, console or json, it overrides log_format of the configurations")
+	rootCmd.Flags().String("log-level", "", "Minimum log level (e.g. debug, info, warn, error), it overrides log_level of the configurations")
 }
@@ -3,17 +3,150 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/rs/zerolog"
 	"gopkg.in/validator.v2"
 )
 
+// DefaultClockSkew is the default allowed difference in seconds between the timestamp of a signed header and the server time
+const DefaultClockSkew = 5
+
+// DefaultHistoryRetention is the default number of kept revisions of each document, including the current one
+const DefaultHistoryRetention = 10
+
+// DefaultDBTimeout is the default time in seconds a request can spend on the database
+const DefaultDBTimeout = 5
+
+// DefaultMaxBodySize is the default maximum size in bytes of a request body
+const DefaultMaxBodySize = 1 << 20
+
+// DefaultSweepInterval is the default time in seconds between the purges of expired documents
+const DefaultSweepInterval = 60
+
+// DefaultMaxNonces is the default maximum number of remembered nonces of signed headers
+const DefaultMaxNonces = 100000
+
+// DefaultRateLimitMaxClients is the default maximum number of tracked rate limit buckets
+const DefaultRateLimitMaxClients = 10000
+
+// default cors policy, all origins are allowed
+var (
+	DefaultCorsAllowedOrigins = []string{"*"}
+	DefaultCorsAllowedMethods = []string{"GET", "POST", "DELETE", "OPTIONS"}
+	DefaultCorsAllowedHeaders = []string{
+		"Accept", "Content-Type", "Content-Length", "Authorization", "If-Match", "If-None-Match", "If-Modified-Since",
+	}
+)
+
+// supported log formats
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+// DefaultLogLevel is the default minimum level of logs
+const DefaultLogLevel = "info"
+
+// supported database drivers
+const (
+	DriverSqlite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+	DriverBolt     = "bolt"
+)
+
 // Configuration struct to hold app configurations
 type Configuration struct {
 	Port    string `json:"port"  validate:"nonzero"`
-	DBFile  string `json:"db_file"  validate:"nonzero"`
 	Version string `json:"version" validate:"nonzero"`
+	// DBDriver is the database of the store, sqlite (default), postgres, memory or bolt
+	DBDriver string `json:"db_driver"`
+	// DBFile is the database file of sqlite or bolt
+	DBFile string `json:"db_file"`
+	// DBDSN is the data source name of postgres
+	DBDSN string `json:"db_dsn"`
+	// DBTimeout is the time in seconds a request can spend on the database before it times out
+	DBTimeout int64 `json:"db_timeout" validate:"min=0"`
+	// ClockSkew is the allowed difference in seconds, in the past or the future, for signed header timestamps
+	ClockSkew int64 `json:"clock_skew" validate:"min=0"`
+	// MaxNonces is the maximum number of remembered nonces of signed headers within the clock skew,
+	// signed requests are rejected with 429 while it is full
+	MaxNonces int `json:"max_nonces" validate:"min=0"`
+	// DisableLegacyHeaders rejects the deprecated signed headers that are not bound to the method, project, key and body
+	DisableLegacyHeaders bool `json:"disable_legacy_headers"`
+	// HistoryRetention is the number of kept revisions of each document, including the current one
+	HistoryRetention int `json:"history_retention" validate:"min=0"`
+	// MaxBodySize is the maximum size in bytes of a request body
+	MaxBodySize int64 `json:"max_body_size" validate:"min=0"`
+	// MaxKeysPerProject is the maximum number of keys in a project, 0 means no limit
+	MaxKeysPerProject int `json:"max_keys_per_project" validate:"min=0"`
+	// MaxProjectsPerPk is the maximum number of projects of a public key, 0 means no limit
+	MaxProjectsPerPk int `json:"max_projects_per_pk" validate:"min=0"`
+	// MaxBytesPerPk is the maximum total size in bytes of the documents of a public key, 0 means no limit
+	MaxBytesPerPk int64 `json:"max_bytes_per_pk" validate:"min=0"`
+	// SweepInterval is the time in seconds between the purges of expired documents
+	SweepInterval int64 `json:"sweep_interval" validate:"min=0"`
+	// RateLimits are the request budgets of clients, requests are not limited by default
+	RateLimits RateLimits `json:"rate_limits"`
+	// Cors is the cross origin policy, all origins are allowed by default
+	Cors Cors `json:"cors"`
+	// TLS serves the api over https if a certificate is given
+	TLS TLS `json:"tls"`
+	// ShutdownDelay is the time in seconds /readyz fails before the server stops, so load balancers can drain traffic
+	ShutdownDelay int64 `json:"shutdown_delay" validate:"min=0"`
+	// LogFormat is the format of the logs, console (default) or json
+	LogFormat string `json:"log_format"`
+	// LogLevel is the minimum level of the logs (e.g. debug, info, warn, error), default is info
+	LogLevel string `json:"log_level"`
+}
+
+// TLS is the certificate of the server and the optional client certificates verification
+type TLS struct {
+	// CertFile and KeyFile are the PEM encoded certificate and private key of the server,
+	// they are reloaded on SIGHUP
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ClientCAFile is a PEM bundle of the authorities of client certificates,
+	// if it is given all clients must present a certificate signed by one of them. It is reloaded on SIGHUP
+	ClientCAFile string `json:"client_ca_file"`
+}
+
+// Enabled is true if the api is served over https
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Cors is the cross origin policy of the api
+type Cors struct {
+	AllowedOrigins []string `json:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods"`
+	AllowedHeaders []string `json:"allowed_headers"`
+	// ExposedHeaders are exposed with ETag and the rate limit headers
+	ExposedHeaders []string `json:"exposed_headers"`
+	// MaxAge is how long in seconds browsers can cache preflight responses
+	MaxAge           int  `json:"max_age" validate:"min=0"`
+	AllowCredentials bool `json:"allow_credentials"`
+}
+
+// RateLimit is a token bucket budget of requests per second with a burst, a zero rate is not limited
+type RateLimit struct {
+	Rate  float64 `json:"rate" validate:"min=0"`
+	Burst int     `json:"burst" validate:"min=0"`
+}
+
+// RateLimits are the read and write budgets of each client IP and each public key
+type RateLimits struct {
+	IPRead  RateLimit `json:"ip_read"`
+	IPWrite RateLimit `json:"ip_write"`
+	PkRead  RateLimit `json:"pk_read"`
+	PkWrite RateLimit `json:"pk_write"`
+	// MaxClients is the maximum number of tracked buckets, the least recently used ones are dropped first
+	MaxClients int `json:"max_clients" validate:"min=0"`
+	// TrustForwardedFor uses the last address of X-Forwarded-For as the client IP, only set it behind a proxy
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
 }
 
 // ReadConfFile read configurations of json file
@@ -29,5 +162,135 @@ func ReadConfFile(path string) (Configuration, error) {
 		return Configuration{}, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	return config, validator.Validate(config)
+	setDefaults(&config)
+
+	if err := validator.Validate(config); err != nil {
+		return config, err
+	}
+
+	if err := validateDB(config); err != nil {
+		return config, err
+	}
+
+	if err := validateCors(config.Cors); err != nil {
+		return config, err
+	}
+
+	if err := ValidateLogs(config.LogFormat, config.LogLevel); err != nil {
+		return config, err
+	}
+
+	return config, validateTLS(config.TLS)
+}
+
+// ValidateLogs validates that the log format and level are supported
+func ValidateLogs(format string, level string) error {
+	if format != LogFormatConsole && format != LogFormatJSON {
+		return fmt.Errorf("unsupported log format %q, supported formats are %s and %s", format, LogFormatConsole, LogFormatJSON)
+	}
+
+	if _, err := zerolog.ParseLevel(level); err != nil {
+		return fmt.Errorf("unsupported log level %q", level)
+	}
+	return nil
+}
+
+// validateTLS validates that the certificate and its key are given together
+func validateTLS(tls TLS) error {
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		return errors.New("tls cert_file and key_file must be given together")
+	}
+
+	if tls.ClientCAFile != "" && !tls.Enabled() {
+		return errors.New("tls client_ca_file requires cert_file and key_file")
+	}
+	return nil
+}
+
+// validateCors validates that credentials are only allowed for listed origins
+func validateCors(cors Cors) error {
+	if !cors.AllowCredentials {
+		return nil
+	}
+
+	for _, origin := range cors.AllowedOrigins {
+		if origin == "*" {
+			return errors.New("cors allow_credentials can't be used when all origins are allowed")
+		}
+	}
+	return nil
+}
+
+// validateDB validates that the connection configurations of the database driver are given
+func validateDB(config Configuration) error {
+	switch config.DBDriver {
+	case DriverSqlite, DriverBolt:
+		if config.DBFile == "" {
+			return fmt.Errorf("db_file is required for %s", config.DBDriver)
+		}
+	case DriverPostgres:
+		if config.DBDSN == "" {
+			return errors.New("db_dsn is required for postgres")
+		}
+	case DriverMemory:
+	default:
+		return fmt.Errorf("unsupported db driver %q", config.DBDriver)
+	}
+
+	return nil
+}
+
+// setDefaults sets the default values of the optional configurations
+func setDefaults(config *Configuration) {
+	if config.DBDriver == "" {
+		config.DBDriver = DriverSqlite
+	}
+
+	if config.DBTimeout == 0 {
+		config.DBTimeout = DefaultDBTimeout
+	}
+
+	if config.ClockSkew == 0 {
+		config.ClockSkew = DefaultClockSkew
+	}
+
+	if config.MaxNonces == 0 {
+		config.MaxNonces = DefaultMaxNonces
+	}
+
+	if config.HistoryRetention == 0 {
+		config.HistoryRetention = DefaultHistoryRetention
+	}
+
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+
+	if config.SweepInterval == 0 {
+		config.SweepInterval = DefaultSweepInterval
+	}
+
+	if config.RateLimits.MaxClients == 0 {
+		config.RateLimits.MaxClients = DefaultRateLimitMaxClients
+	}
+
+	if config.LogFormat == "" {
+		config.LogFormat = LogFormatConsole
+	}
+
+	if config.LogLevel == "" {
+		config.LogLevel = DefaultLogLevel
+	}
+
+	if len(config.Cors.AllowedOrigins) == 0 {
+		config.Cors.AllowedOrigins = DefaultCorsAllowedOrigins
+	}
+
+	if len(config.Cors.AllowedMethods) == 0 {
+		config.Cors.AllowedMethods = DefaultCorsAllowedMethods
+	}
+
+	if len(config.Cors.AllowedHeaders) == 0 {
+		config.Cors.AllowedHeaders = DefaultCorsAllowedHeaders
+	}
 }
@@ -151,3 +151,443 @@ func TestParseConf(t *testing.T) {
 		assert.Error(t, err, "db file is required")
 	})
 }
+
+func TestDBDriver(t *testing.T) {
+	t.Run("postgres driver", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_driver": "postgres",
+	"db_dsn": "postgres://pkid@localhost/pkid"
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.Equal(t, got.DBDriver, DriverPostgres)
+	})
+
+	t.Run("memory driver", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_driver": "memory"
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.Equal(t, got.DBDriver, DriverMemory)
+	})
+
+	t.Run("bolt driver no file", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_driver": "bolt"
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+
+	t.Run("postgres driver no dsn", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_driver": "postgres",
+	"db_file": "pkid.db"
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported driver", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_driver": "mysql",
+	"db_file": "pkid.db"
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+}
+
+func TestRateLimits(t *testing.T) {
+	t.Run("rate limits", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"rate_limits": {
+		"ip_write": {"rate": 0.5, "burst": 5},
+		"pk_read": {"rate": 10}
+	}
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.Equal(t, RateLimit{Rate: 0.5, Burst: 5}, got.RateLimits.IPWrite)
+		assert.Equal(t, RateLimit{Rate: 10}, got.RateLimits.PkRead)
+		assert.Equal(t, DefaultRateLimitMaxClients, got.RateLimits.MaxClients)
+	})
+
+	t.Run("negative rate", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"rate_limits": {
+		"ip_read": {"rate": -1}
+	}
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+}
+
+func TestCors(t *testing.T) {
+	t.Run("default cors", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(rightConfig), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultCorsAllowedOrigins, got.Cors.AllowedOrigins)
+		assert.Equal(t, DefaultCorsAllowedMethods, got.Cors.AllowedMethods)
+	})
+
+	t.Run("credentials with any origin", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"cors": {
+		"allow_credentials": true
+	}
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+}
+
+func TestTLS(t *testing.T) {
+	t.Run("tls", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"tls": {
+		"cert_file": "server.crt",
+		"key_file": "server.key",
+		"client_ca_file": "ca.crt"
+	}
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.True(t, got.TLS.Enabled())
+		assert.Equal(t, "ca.crt", got.TLS.ClientCAFile)
+	})
+
+	t.Run("no tls", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(rightConfig), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.False(t, got.TLS.Enabled())
+	})
+
+	t.Run("cert without key", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"tls": {
+		"cert_file": "server.crt"
+	}
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+
+	t.Run("client ca without cert", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"tls": {
+		"client_ca_file": "ca.crt"
+	}
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+}
+
+func TestShutdownDelay(t *testing.T) {
+	t.Run("negative shutdown delay", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"shutdown_delay": -1
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+}
+
+func TestMaxNonces(t *testing.T) {
+	t.Run("default max nonces", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(rightConfig), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultMaxNonces, got.MaxNonces)
+	})
+
+	t.Run("negative max nonces", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"max_nonces": -1
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+}
+
+func TestSweepInterval(t *testing.T) {
+	t.Run("default sweep interval", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(rightConfig), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(DefaultSweepInterval), got.SweepInterval)
+	})
+
+	t.Run("negative sweep interval", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"sweep_interval": -1
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+}
+
+func TestLogs(t *testing.T) {
+	t.Run("default logs", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(rightConfig), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.Equal(t, LogFormatConsole, got.LogFormat)
+		assert.Equal(t, DefaultLogLevel, got.LogLevel)
+	})
+
+	t.Run("unsupported log format", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"log_format": "xml"
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported log level", func(t *testing.T) {
+		assert.Error(t, ValidateLogs(LogFormatJSON, "verbose"))
+		assert.NoError(t, ValidateLogs(LogFormatJSON, "debug"))
+	})
+}
+
+func TestDefaults(t *testing.T) {
+	t.Run("default clock skew", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(rightConfig), 0644)
+		assert.NoError(t, err)
+
+		got, err := ReadConfFile(configPath)
+		assert.NoError(t, err)
+		assert.Equal(t, got.ClockSkew, int64(DefaultClockSkew))
+		assert.Equal(t, got.DBTimeout, int64(DefaultDBTimeout))
+		assert.Equal(t, got.MaxBodySize, int64(DefaultMaxBodySize))
+		assert.Equal(t, got.MaxKeysPerProject, 0)
+	})
+
+	t.Run("negative clock skew", func(t *testing.T) {
+		config := `
+{
+	"port": ":3000",
+	"version": "v1",
+	"db_file": "pkid.db",
+	"clock_skew": -1
+}
+	`
+
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "/config.json")
+
+		err := os.WriteFile(configPath, []byte(config), 0644)
+		assert.NoError(t, err)
+
+		_, err = ReadConfFile(configPath)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,101 @@
+// Package metrics for prometheus metrics of pkid
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pkid"
+
+// Metrics holds the collectors of pkid in their own registry
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests          *prometheus.CounterVec
+	requestDuration   *prometheus.HistogramVec
+	signatureFailures *prometheus.CounterVec
+	storeDuration     *prometheus.HistogramVec
+	storeErrors       *prometheus.CounterVec
+}
+
+// NewMetrics creates the pkid collectors with the go runtime and process collectors
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of http requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of http requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		signatureFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signature_failures_total",
+			Help:      "Number of rejected signed headers and payloads by reason.",
+		}, []string{"reason"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_operation_duration_seconds",
+			Help:      "Latency of store operations by driver and operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"driver", "operation"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "store_errors_total",
+			Help:      "Number of failed store operations by driver and operation.",
+		}, []string{"driver", "operation"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.signatureFailures,
+		m.storeDuration,
+		m.storeErrors,
+	)
+
+	return m
+}
+
+// Register registers another collector, e.g. one that reads its values on each scrape
+func (m *Metrics) Register(collector prometheus.Collector) error {
+	return m.registry.Register(collector)
+}
+
+// Handler serves the metrics in the prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served http request, route is the template of the matched route
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	labels := prometheus.Labels{"route": route, "method": method, "status": strconv.Itoa(status)}
+	m.requests.With(labels).Inc()
+	m.requestDuration.With(labels).Observe(duration.Seconds())
+}
+
+// SignatureFailure records a rejected signed header or payload
+func (m *Metrics) SignatureFailure(reason string) {
+	m.signatureFailures.WithLabelValues(reason).Inc()
+}
+
+// ObserveStore records a store operation and whether it failed
+func (m *Metrics) ObserveStore(driver, operation string, duration time.Duration, failed bool) {
+	m.storeDuration.WithLabelValues(driver, operation).Observe(duration.Seconds())
+	if failed {
+		m.storeErrors.WithLabelValues(driver, operation).Inc()
+	}
+}
@@ -1,23 +1,80 @@
 // Package middlewares for middleware between api and backend
 package middlewares
 
-import "net/http"
-
-// EnableCors enables cors middleware
-func EnableCors(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		setupCorsResponse(w, r)
-		h.ServeHTTP(w, r)
-	})
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// exposedHeaders are the response headers clients always need to read
+var exposedHeaders = []string{"ETag", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", RequestIDHeader}
+
+// CorsPolicy is the cross origin policy of the api
+type CorsPolicy struct {
+	// AllowedOrigins are the allowed origins, "*" allows all of them
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are exposed with the headers clients always need
+	ExposedHeaders []string
+	// MaxAge is how long in seconds preflight responses can be cached, 0 doesn't send it
+	MaxAge           int
+	AllowCredentials bool
+}
+
+// allowsOrigin checks if the origin is allowed
+func (p CorsPolicy) allowsOrigin(origin string) (allowed bool, any bool) {
+	for _, allowedOrigin := range p.AllowedOrigins {
+		if allowedOrigin == "*" {
+			return true, true
+		}
+
+		if strings.EqualFold(allowedOrigin, origin) {
+			allowed = true
+		}
+	}
+	return allowed, false
 }
 
-func setupCorsResponse(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Authorization")
+// Cors is the cors middleware of the given policy, preflight requests are answered without calling the handler
+func Cors(policy CorsPolicy) func(http.Handler) http.Handler {
+	exposed := strings.Join(append(append([]string{}, exposedHeaders...), policy.ExposedHeaders...), ", ")
+	methods := strings.Join(policy.AllowedMethods, ", ")
+	headers := strings.Join(policy.AllowedHeaders, ", ")
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowed, any := policy.allowsOrigin(origin)
+
+			if origin != "" && allowed {
+				if any && !policy.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Add("Vary", "Origin")
+				}
+
+				if policy.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+			}
+
+			if r.Method != http.MethodOptions {
+				h.ServeHTTP(w, r)
+				return
+			}
 
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
+			if origin != "" && allowed {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				if policy.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
 	}
 }
@@ -0,0 +1,87 @@
+// Package middlewares for middleware between api and backend
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCors(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(policy CorsPolicy, method, origin string) *httptest.ResponseRecorder {
+		called = false
+
+		req := httptest.NewRequest(method, "/", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+
+		response := httptest.NewRecorder()
+		Cors(policy)(handler).ServeHTTP(response, req)
+		return response
+	}
+
+	policy := CorsPolicy{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "If-Match"},
+		MaxAge:         600,
+	}
+
+	t.Run("test_preflight", func(t *testing.T) {
+		response := serve(policy, http.MethodOptions, "https://app.example.com")
+		assert.False(t, called, "preflight should not call the handler")
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		assert.Equal(t, "https://app.example.com", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "GET, POST", response.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Authorization, If-Match", response.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "600", response.Header().Get("Access-Control-Max-Age"))
+		assert.Equal(t, "Origin", response.Header().Get("Vary"))
+	})
+
+	t.Run("test_allowed_origin", func(t *testing.T) {
+		response := serve(policy, http.MethodGet, "https://app.example.com")
+		assert.True(t, called)
+		assert.Equal(t, "https://app.example.com", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, response.Header().Get("Access-Control-Expose-Headers"), "ETag")
+		assert.Contains(t, response.Header().Get("Access-Control-Expose-Headers"), "Retry-After")
+		assert.Contains(t, response.Header().Get("Access-Control-Expose-Headers"), "X-Request-ID")
+		assert.Empty(t, response.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("test_other_origin", func(t *testing.T) {
+		response := serve(policy, http.MethodGet, "https://evil.example.com")
+		assert.True(t, called)
+		assert.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+
+		response = serve(policy, http.MethodOptions, "https://evil.example.com")
+		assert.False(t, called)
+		assert.Empty(t, response.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("test_any_origin", func(t *testing.T) {
+		response := serve(CorsPolicy{AllowedOrigins: []string{"*"}}, http.MethodGet, "https://app.example.com")
+		assert.Equal(t, "*", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, response.Header().Get("Vary"))
+	})
+
+	t.Run("test_credentials", func(t *testing.T) {
+		credentials := policy
+		credentials.AllowCredentials = true
+
+		response := serve(credentials, http.MethodGet, "https://app.example.com")
+		assert.Equal(t, "https://app.example.com", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", response.Header().Get("Access-Control-Allow-Credentials"))
+	})
+}
@@ -0,0 +1,77 @@
+// Package middlewares for middleware between api and backend
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestIDHeader is the header of the request ID, it is propagated from the request or generated
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the propagated request IDs, longer ones are replaced
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID gets the ID of the request of the given context, it is empty outside of the Logging middleware
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID checks that a propagated request ID is short and printable so it is safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Logging assigns an ID to each request, or keeps the X-Request-ID of the request, and logs the request when it is served.
+// The logger of the request context holds the request ID so handlers can log with log.Ctx
+func Logging(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := log.Logger.With().Str("request_id", id).Logger()
+		ctx := context.WithValue(logger.WithContext(r.Context()), requestIDKey{}, id)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(recorder, r.WithContext(ctx))
+
+		logger.Info().
+			Str("method", r.Method).
+			Str("route", routeTemplate(r)).
+			Str("pk", mux.Vars(r)["pk"]).
+			Int("status", recorder.statusCode()).
+			Dur("latency", time.Since(start)).
+			Int("size", recorder.size).
+			Msg("request is served")
+	})
+}
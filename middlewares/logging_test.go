@@ -0,0 +1,82 @@
+// Package middlewares for middleware between api and backend
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogging(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&logs)
+	defer func() { log.Logger = logger }()
+
+	var requestID string
+	r := mux.NewRouter()
+	r.HandleFunc("/{pk}/{project}", func(w http.ResponseWriter, r *http.Request) {
+		requestID = RequestID(r.Context())
+		log.Ctx(r.Context()).Info().Msg("handled")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("body"))
+	})
+	r.Use(Logging)
+
+	serve := func(id string) *httptest.ResponseRecorder {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/pk/project", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, req)
+		return response
+	}
+
+	t.Run("test_propagated_id", func(t *testing.T) {
+		response := serve("my-request")
+		assert.Equal(t, "my-request", response.Header().Get(RequestIDHeader))
+		assert.Equal(t, "my-request", requestID)
+
+		lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+		assert.Len(t, lines, 2)
+
+		var handled map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &handled))
+		assert.Equal(t, "my-request", handled["request_id"], "handler logs should hold the request ID")
+
+		var access map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &access))
+		assert.Equal(t, "my-request", access["request_id"])
+		assert.Equal(t, http.MethodPost, access["method"])
+		assert.Equal(t, "/{pk}/{project}", access["route"])
+		assert.Equal(t, "pk", access["pk"])
+		assert.Equal(t, float64(http.StatusCreated), access["status"])
+		assert.Equal(t, float64(len("body")), access["size"])
+		assert.Contains(t, access, "latency")
+	})
+
+	t.Run("test_generated_id", func(t *testing.T) {
+		response := serve("")
+		assert.Len(t, response.Header().Get(RequestIDHeader), 32)
+		assert.Equal(t, response.Header().Get(RequestIDHeader), requestID)
+	})
+
+	t.Run("test_invalid_id", func(t *testing.T) {
+		for _, id := range []string{"with space", strings.Repeat("a", maxRequestIDLength+1)} {
+			response := serve(id)
+			assert.NotEqual(t, id, response.Header().Get(RequestIDHeader))
+			assert.Len(t, response.Header().Get(RequestIDHeader), 32)
+		}
+	})
+}
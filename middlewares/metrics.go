@@ -0,0 +1,27 @@
+// Package middlewares for middleware between api and backend
+package middlewares
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestObserver records the status and latency of served requests
+type RequestObserver interface {
+	ObserveRequest(route, method string, status int, duration time.Duration)
+}
+
+// Metrics reports each request by the template of its matched route, so the path variables (e.g. {pk})
+// don't make a series per value
+func Metrics(observer RequestObserver) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+
+			h.ServeHTTP(recorder, r)
+
+			observer.ObserveRequest(routeTemplate(r), r.Method, recorder.statusCode(), time.Since(start))
+		})
+	}
+}
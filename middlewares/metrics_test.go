@@ -0,0 +1,48 @@
+// Package middlewares for middleware between api and backend
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// observedRequest is a request reported to the fake observer
+type observedRequest struct {
+	route  string
+	method string
+	status int
+}
+
+type fakeRequestObserver []observedRequest
+
+func (o *fakeRequestObserver) ObserveRequest(route, method string, status int, duration time.Duration) {
+	*o = append(*o, observedRequest{route: route, method: method, status: status})
+}
+
+func TestMetrics(t *testing.T) {
+	observer := &fakeRequestObserver{}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/{pk}/{project}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.HandleFunc("/{pk}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	r.Use(Metrics(observer))
+
+	for _, path := range []string{"/pk1/project", "/pk2/project", "/pk1"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, []observedRequest{
+		{route: "/{pk}/{project}", method: http.MethodGet, status: http.StatusNotFound},
+		{route: "/{pk}/{project}", method: http.MethodGet, status: http.StatusNotFound},
+		{route: "/{pk}", method: http.MethodGet, status: http.StatusOK},
+	}, []observedRequest(*observer))
+}
@@ -0,0 +1,221 @@
+// Package middlewares for middleware between api and backend
+package middlewares
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rawdaGastan/pkid/pkg"
+)
+
+// RateLimitedCode is the machine readable code of rate limited responses
+const RateLimitedCode = pkg.CodeRateLimited
+
+// Limit is a token bucket budget, Rate tokens are added per second up to Burst tokens and each request takes one.
+// A zero rate is not limited
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// burst gets the size of the bucket, it is at least one second of tokens
+func (l Limit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// RateLimits are the read and write budgets of each client IP and each public key
+type RateLimits struct {
+	IPRead  Limit
+	IPWrite Limit
+	PkRead  Limit
+	PkWrite Limit
+	// MaxClients bounds the number of tracked buckets, the least recently used buckets are dropped first
+	MaxClients int
+	// TrustForwardedFor uses the last address of the X-Forwarded-For header as the client IP,
+	// it should only be set behind a proxy that sets it
+	TrustForwardedFor bool
+}
+
+// bucket is the state of a token bucket
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter limits requests with token buckets of the client IP and the {pk} of the request,
+// the buckets are kept in a bounded least recently used cache
+type RateLimiter struct {
+	limits RateLimits
+
+	mutex   sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+// NewRateLimiter creates a new rate limiter with the given budgets
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		buckets: map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Limit is the rate limiting middleware, limited requests get 429 with a Retry-After header
+func (l *RateLimiter) Limit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, remaining, limit, retryAfter := l.take(l.requestBuckets(r))
+
+		if limit > 0 {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		}
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_ = json.NewEncoder(w).Encode(struct {
+				Code      string                 `json:"code"`
+				Message   string                 `json:"message"`
+				Details   map[string]interface{} `json:"details"`
+				RequestID string                 `json:"request_id,omitempty"`
+				Err       string                 `json:"err"`
+			}{
+				Code:      RateLimitedCode,
+				Message:   "too many requests",
+				Details:   map[string]interface{}{"retry_after": seconds},
+				RequestID: RequestID(r.Context()),
+				Err:       "too many requests",
+			})
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requestBucket is a bucket a request takes a token from
+type requestBucket struct {
+	key   string
+	limit Limit
+}
+
+// requestBuckets gets the buckets of the client IP and the public key of the request for its kind
+func (l *RateLimiter) requestBuckets(r *http.Request) []requestBucket {
+	kind, ipLimit, pkLimit := "read", l.limits.IPRead, l.limits.PkRead
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		kind, ipLimit, pkLimit = "write", l.limits.IPWrite, l.limits.PkWrite
+	}
+
+	var buckets []requestBucket
+	if ipLimit.Rate > 0 {
+		buckets = append(buckets, requestBucket{key: fmt.Sprintf("ip:%s:%s", kind, l.clientIP(r)), limit: ipLimit})
+	}
+
+	if pk := mux.Vars(r)["pk"]; pk != "" && pkLimit.Rate > 0 {
+		buckets = append(buckets, requestBucket{key: fmt.Sprintf("pk:%s:%s", kind, pk), limit: pkLimit})
+	}
+
+	return buckets
+}
+
+// clientIP gets the IP of the client of the request
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	if l.limits.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addresses := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// take takes a token from each of the buckets only if all of them have one.
+// It gets the remaining tokens and the size of the most limiting bucket, and how long to wait if not allowed
+func (l *RateLimiter) take(requestBuckets []requestBucket) (allowed bool, remaining int, limit int, retryAfter time.Duration) {
+	if len(requestBuckets) == 0 {
+		return true, 0, 0, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	buckets := make([]*bucket, len(requestBuckets))
+	allowed = true
+	remaining = math.MaxInt
+	for i, requestBucket := range requestBuckets {
+		b := l.bucket(requestBucket.key, requestBucket.limit, now)
+		buckets[i] = b
+
+		if b.tokens < 1 {
+			allowed = false
+			wait := time.Duration((1 - b.tokens) / requestBucket.limit.Rate * float64(time.Second))
+			if wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+
+		if tokens := int(b.tokens); tokens < remaining {
+			remaining = tokens
+			limit = int(requestBucket.limit.burst())
+		}
+	}
+
+	if !allowed {
+		return false, 0, limit, retryAfter
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, remaining - 1, limit, 0
+}
+
+// bucket gets the refilled bucket of the key, it creates a full one if it is not tracked,
+// the least recently used bucket is dropped if there are too many of them
+func (l *RateLimiter) bucket(key string, limit Limit, now time.Time) *bucket {
+	if element, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(element)
+
+		b := element.Value.(*bucket)
+		b.tokens = math.Min(limit.burst(), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+		b.last = now
+		return b
+	}
+
+	b := &bucket{key: key, tokens: limit.burst(), last: now}
+	l.buckets[key] = l.lru.PushFront(b)
+
+	if l.limits.MaxClients > 0 && l.lru.Len() > l.limits.MaxClients {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*bucket).key)
+	}
+
+	return b
+}
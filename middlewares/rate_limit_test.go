@@ -0,0 +1,113 @@
+// Package middlewares for middleware between api and backend
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// limitedRouter serves every pk route behind the rate limiter with a fake clock
+func limitedRouter(limits RateLimits, now *time.Time) (*mux.Router, *RateLimiter) {
+	limiter := NewRateLimiter(limits)
+	limiter.now = func() time.Time { return *now }
+
+	r := mux.NewRouter()
+	r.HandleFunc("/{pk}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Use(limiter.Limit)
+
+	return r, limiter
+}
+
+// serve sends a request of the method to the pk route from the remote address
+func serve(h http.Handler, method, pk, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/"+pk, nil)
+	req.RemoteAddr = remoteAddr
+
+	response := httptest.NewRecorder()
+	h.ServeHTTP(response, req)
+	return response
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("test_burst_and_refill", func(t *testing.T) {
+		now := time.Now()
+		r, _ := limitedRouter(RateLimits{IPWrite: Limit{Rate: 0.5, Burst: 2}}, &now)
+
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodPost, "pk", "1.1.1.1:1000").Code)
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodPost, "pk", "1.1.1.1:1000").Code)
+
+		response := serve(r, http.MethodPost, "pk", "1.1.1.1:1000")
+		assert.Equal(t, http.StatusTooManyRequests, response.Code)
+		assert.Equal(t, "2", response.Header().Get("Retry-After"))
+		assert.Contains(t, response.Body.String(), RateLimitedCode)
+
+		// other clients and reads have their own budgets
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodPost, "pk", "2.2.2.2:1000").Code)
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "pk", "1.1.1.1:1000").Code)
+
+		now = now.Add(2 * time.Second)
+		response = serve(r, http.MethodPost, "pk", "1.1.1.1:1000")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "2", response.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "0", response.Header().Get("X-RateLimit-Remaining"))
+	})
+
+	t.Run("test_pk_budget", func(t *testing.T) {
+		now := time.Now()
+		r, _ := limitedRouter(RateLimits{PkRead: Limit{Rate: 1}}, &now)
+
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "pk", "1.1.1.1:1000").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(r, http.MethodGet, "pk", "2.2.2.2:1000").Code)
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "other", "2.2.2.2:1000").Code)
+	})
+
+	t.Run("test_limited_request_takes_no_tokens", func(t *testing.T) {
+		now := time.Now()
+		r, _ := limitedRouter(RateLimits{IPRead: Limit{Rate: 1, Burst: 2}, PkRead: Limit{Rate: 1}}, &now)
+
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "pk", "1.1.1.1:1000").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(r, http.MethodGet, "pk", "1.1.1.1:1000").Code)
+
+		// the ip bucket still has its second token
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "other", "1.1.1.1:1000").Code)
+	})
+
+	t.Run("test_forwarded_for", func(t *testing.T) {
+		now := time.Now()
+		r, _ := limitedRouter(RateLimits{IPRead: Limit{Rate: 1}, TrustForwardedFor: true}, &now)
+
+		req := httptest.NewRequest(http.MethodGet, "/pk", nil)
+		req.Header.Set("X-Forwarded-For", "3.3.3.3, 4.4.4.4")
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, req)
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		req.Header.Set("X-Forwarded-For", "5.5.5.5, 4.4.4.4")
+		response = httptest.NewRecorder()
+		r.ServeHTTP(response, req)
+		assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	})
+
+	t.Run("test_bounded_buckets", func(t *testing.T) {
+		now := time.Now()
+		r, limiter := limitedRouter(RateLimits{IPRead: Limit{Rate: 1}, MaxClients: 2}, &now)
+
+		for _, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"} {
+			assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "pk", ip+":1000").Code)
+		}
+
+		assert.Equal(t, 2, limiter.lru.Len())
+		assert.Len(t, limiter.buckets, 2)
+
+		// the least recently used bucket is dropped, so its client starts with a full bucket
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "pk", "1.1.1.1:1000").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(r, http.MethodGet, "pk", "3.3.3.3:1000").Code)
+	})
+}
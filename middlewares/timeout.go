@@ -0,0 +1,20 @@
+// Package middlewares for middleware between api and backend
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeout cancels the context of the request after the given timeout
+func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
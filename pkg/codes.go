@@ -0,0 +1,56 @@
+package pkg
+
+// Codes of the error responses of the pkid api, they are stable so clients can check them instead of the messages.
+// Error responses are {"code": code, "message": message, "details": {...}}
+const (
+	// CodeBadRequest is a malformed request that has no more specific code
+	CodeBadRequest = "BAD_REQUEST"
+	// CodeInvalidName is a project or key that is a reserved route segment like `_batch`
+	CodeInvalidName = "INVALID_NAME"
+	// CodeInvalidPublicKey is a public key that is not hex encoded
+	CodeInvalidPublicKey = "INVALID_PUBLIC_KEY"
+	// CodePayloadInvalid is a signed payload envelope that is missing fields or has invalid ones
+	CodePayloadInvalid = "PAYLOAD_INVALID"
+	// CodeDataVersionUnsupported is a signed payload envelope of an unsupported data_version
+	CodeDataVersionUnsupported = "DATA_VERSION_UNSUPPORTED"
+	// CodeBatchTooLarge is a batch request with more documents than the batch limit
+	CodeBatchTooLarge = "BATCH_TOO_LARGE"
+
+	// CodeAuthorizationMissing is a write request without a signed Authorization header
+	CodeAuthorizationMissing = "AUTHORIZATION_MISSING"
+	// CodeSignatureInvalid is a signed header or payload that is not signed by the public key of the request
+	CodeSignatureInvalid = "SIGNATURE_INVALID"
+	// CodeHeaderInvalid is a signed header that is malformed or not bound to the request
+	CodeHeaderInvalid = "HEADER_INVALID"
+	// CodeHeaderExpired is a signed header with a timestamp out of the allowed clock skew
+	CodeHeaderExpired = "HEADER_EXPIRED"
+	// CodeHeaderVersionUnsupported is a signed header of a version that is not accepted
+	CodeHeaderVersionUnsupported = "HEADER_VERSION_UNSUPPORTED"
+	// CodeHeaderReplayed is a signed header that is already used
+	CodeHeaderReplayed = "HEADER_REPLAYED"
+
+	// CodeNotFound is a missing key or revision
+	CodeNotFound = "NOT_FOUND"
+	// CodeVersionConflict is a conditional write whose expected version doesn't match the current version
+	CodeVersionConflict = "VERSION_CONFLICT"
+
+	// CodeBodyTooLarge is a request body larger than the max_body_size
+	CodeBodyTooLarge = "BODY_TOO_LARGE"
+	// CodeProjectsQuotaExceeded is a write that exceeds the projects quota of the public key
+	CodeProjectsQuotaExceeded = "PROJECTS_QUOTA_EXCEEDED"
+	// CodeKeysQuotaExceeded is a write that exceeds the keys quota of the project
+	CodeKeysQuotaExceeded = "KEYS_QUOTA_EXCEEDED"
+	// CodeBytesQuotaExceeded is a write that exceeds the bytes quota of the public key
+	CodeBytesQuotaExceeded = "BYTES_QUOTA_EXCEEDED"
+	// CodeRateLimited is a request that exceeds a rate limit, it can be retried after the Retry-After header
+	CodeRateLimited = "RATE_LIMITED"
+
+	// CodeDatabaseTimeout is a request that took longer than the db_timeout
+	CodeDatabaseTimeout = "DATABASE_TIMEOUT"
+	// CodeRequestCanceled is a request that is canceled by the client
+	CodeRequestCanceled = "REQUEST_CANCELED"
+	// CodeNotReady is a server that can't serve requests, e.g. it is shutting down
+	CodeNotReady = "NOT_READY"
+	// CodeInternal is an unexpected server error
+	CodeInternal = "INTERNAL_ERROR"
+)
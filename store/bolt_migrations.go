@@ -0,0 +1,166 @@
+// package store is for pkid storage
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	// boltMetaBucket keeps the schema version of the db
+	boltMetaBucket = []byte("meta")
+	// boltDocumentsBucket keeps the documents in nested buckets of pk then project, keyed by the document key
+	boltDocumentsBucket = []byte("documents")
+	// boltHistoryBucket keeps the revisions in nested buckets of pk, project then key, keyed by the revision
+	boltHistoryBucket = []byte("history")
+	// boltTombstonesBucket keeps the highest revision of the deleted documents of each project in nested buckets of pk,
+	// keyed by the project
+	boltTombstonesBucket = []byte("tombstones")
+	// boltExpiryBucket indexes the documents that expire by their expiry, its keys are the big endian
+	// expiry unix nanoseconds followed by the document key, so the expired documents are the first keys
+	boltExpiryBucket = []byte("expiry")
+
+	boltVersionKey = []byte("version")
+)
+
+// boltMigrations are applied in order, the schema version of the db is the number of applied migrations
+// and it is kept in the meta bucket
+var boltMigrations = []func(*bbolt.Tx) error{
+	createBoltBuckets,
+	addBoltEnvelopeMetadata,
+	createBoltTombstonesBucket,
+	createBoltExpiryIndex,
+}
+
+// createBoltBuckets creates the documents and history buckets
+func createBoltBuckets(tx *bbolt.Tx) error {
+	if _, err := tx.CreateBucketIfNotExists(boltDocumentsBucket); err != nil {
+		return err
+	}
+
+	_, err := tx.CreateBucketIfNotExists(boltHistoryBucket)
+	return err
+}
+
+// addBoltEnvelopeMetadata adds the envelope metadata of the documents, it is read from the stored values.
+// History revisions were kept as their raw values, they are stored like the documents with their metadata
+func addBoltEnvelopeMetadata(tx *bbolt.Tx) error {
+	documents := tx.Bucket(boltDocumentsBucket)
+	err := forEachLeafBucket(documents, 2, func(bucket *bbolt.Bucket) error {
+		return updateBoltValues(bucket, func(_ []byte, value []byte) (interface{}, error) {
+			var stored boltDocument
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return nil, err
+			}
+
+			envelope := envelopeOf(stored.Value)
+			stored.IsEncrypted = envelope.IsEncrypted
+			stored.DataVersion = envelope.DataVersion
+			return stored, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	history := tx.Bucket(boltHistoryBucket)
+	return forEachLeafBucket(history, 3, func(bucket *bbolt.Bucket) error {
+		return updateBoltValues(bucket, func(revision []byte, value []byte) (interface{}, error) {
+			envelope := envelopeOf(string(value))
+			return boltDocument{
+				Value:       string(value),
+				Revision:    int64(binary.BigEndian.Uint64(revision)),
+				IsEncrypted: envelope.IsEncrypted,
+				DataVersion: envelope.DataVersion,
+			}, nil
+		})
+	})
+}
+
+// createBoltTombstonesBucket creates the tombstones bucket
+func createBoltTombstonesBucket(tx *bbolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(boltTombstonesBucket)
+	return err
+}
+
+// createBoltExpiryIndex creates the expiry index of the documents
+func createBoltExpiryIndex(tx *bbolt.Tx) error {
+	if _, err := tx.CreateBucketIfNotExists(boltExpiryBucket); err != nil {
+		return err
+	}
+
+	var expiring []DocKey
+	var expiries []int64
+	err := forEachBoltDocument(tx, func(key DocKey, stored boltDocument) {
+		if stored.ExpiresAt != 0 {
+			expiring = append(expiring, key)
+			expiries = append(expiries, stored.ExpiresAt)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, key := range expiring {
+		if err := putExpiry(tx, key, expiries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachLeafBucket calls fn for each bucket nested at the given depth under the root bucket
+func forEachLeafBucket(root *bbolt.Bucket, depth int, fn func(*bbolt.Bucket) error) error {
+	if depth == 0 {
+		return fn(root)
+	}
+
+	var names [][]byte
+	err := root.ForEach(func(name, value []byte) error {
+		if value == nil {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := forEachLeafBucket(root.Bucket(name), depth-1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateBoltValues replaces each value of the bucket with the json encoding of what update returns for it
+func updateBoltValues(bucket *bbolt.Bucket, update func(key []byte, value []byte) (interface{}, error)) error {
+	updated := map[string][]byte{}
+	err := bucket.ForEach(func(key, value []byte) error {
+		newValue, err := update(key, value)
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(newValue)
+		if err != nil {
+			return err
+		}
+
+		updated[string(key)] = encoded
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, value := range updated {
+		if err := bucket.Put([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,930 @@
+// package store is for pkid storage
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// BoltStore is a pure go embedded store backed by a bbolt file
+type BoltStore struct {
+	db           *bbolt.DB
+	historyLimit int
+	now          func() time.Time
+}
+
+// boltDocument is the stored value of a document and of its revisions in the history
+type boltDocument struct {
+	Value       string `json:"value"`
+	Revision    int64  `json:"revision"`
+	IsEncrypted bool   `json:"is_encrypted"`
+	DataVersion int    `json:"data_version"`
+	// CreatedAt and UpdatedAt are unix nanoseconds, they are missing for documents written before they are recorded
+	CreatedAt int64 `json:"created_at,omitempty"`
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+	// ExpiresAt is unix nanoseconds, it is missing for documents that never expire
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// metadata gets the metadata of the stored value
+func (stored boltDocument) metadata() Metadata {
+	return storedMetadata(stored.Value, stored.CreatedAt, stored.UpdatedAt, stored.ExpiresAt)
+}
+
+// document gets the document of the given key from its stored value
+func (stored boltDocument) document(key DocKey) Document {
+	return Document{
+		DocKey:   key,
+		Envelope: Envelope{IsEncrypted: stored.IsEncrypted, DataVersion: stored.DataVersion},
+		Metadata: stored.metadata(),
+		Value:    stored.Value,
+		Revision: stored.Revision,
+	}
+}
+
+// NewBoltStore creates a new instance of bolt database
+func NewBoltStore() *BoltStore {
+	return &BoltStore{historyLimit: DefaultHistoryLimit, now: time.Now}
+}
+
+// SetConn opens the bolt db file
+func (bolt *BoltStore) SetConn(filePath string) error {
+	if filePath == "" {
+		return errors.New("no file path provided")
+	}
+
+	db, err := bbolt.Open(filePath, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	bolt.db = db
+	return nil
+}
+
+// SetHistoryLimit sets how many revisions of each document are kept, including the current one
+func (bolt *BoltStore) SetHistoryLimit(limit int) {
+	bolt.historyLimit = limit
+}
+
+// SetClock sets the clock of the write times and expiry of documents
+func (bolt *BoltStore) SetClock(now func() time.Time) {
+	bolt.now = now
+}
+
+// Migrate applies the migrations that are not applied yet in one transaction
+func (bolt *BoltStore) Migrate(ctx context.Context) error {
+	return bolt.db.Update(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+
+		var version uint64
+		if value := meta.Get(boltVersionKey); value != nil {
+			version = binary.BigEndian.Uint64(value)
+		}
+
+		for ; version < uint64(len(boltMigrations)); version++ {
+			if err := boltMigrations[version](tx); err != nil {
+				return fmt.Errorf("migration %d failed: %w", version+1, err)
+			}
+		}
+
+		return meta.Put(boltVersionKey, encodeUint(version))
+	})
+}
+
+// Ping checks that the database file is open
+func (bolt *BoltStore) Ping(ctx context.Context) error {
+	return bolt.db.View(func(tx *bbolt.Tx) error {
+		return ctx.Err()
+	})
+}
+
+// Migrated checks that all migrations are applied, the database can be migrated further by a newer version
+func (bolt *BoltStore) Migrated(ctx context.Context) (bool, error) {
+	var version uint64
+	err := bolt.db.View(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if meta := tx.Bucket(boltMetaBucket); meta != nil {
+			if value := meta.Get(boltVersionKey); value != nil {
+				version = binary.BigEndian.Uint64(value)
+			}
+		}
+		return nil
+	})
+
+	return version >= uint64(len(boltMigrations)), err
+}
+
+// Set adds a new document or updates the existing one and increases its revision
+func (bolt *BoltStore) Set(ctx context.Context, doc Document) (int64, error) {
+	if !doc.valid() {
+		return 0, errors.New("invalid key")
+	}
+
+	var revision int64
+	err := bolt.db.Update(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		current, _, err := bolt.getLiveDocument(tx, doc.DocKey)
+		if err != nil {
+			return err
+		}
+
+		revision, err = bolt.write(tx, doc, current)
+		return err
+	})
+	return revision, err
+}
+
+// SetMany adds or updates all documents in one transaction
+func (bolt *BoltStore) SetMany(ctx context.Context, docs []Document) ([]int64, error) {
+	for _, doc := range docs {
+		if !doc.valid() {
+			return nil, errors.New("invalid key")
+		}
+	}
+
+	var revisions []int64
+	err := bolt.db.Update(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		revisions = make([]int64, 0, len(docs))
+		for _, doc := range docs {
+			current, _, err := bolt.getLiveDocument(tx, doc.DocKey)
+			if err != nil {
+				return err
+			}
+
+			revision, err := bolt.write(tx, doc, current)
+			if err != nil {
+				return err
+			}
+
+			revisions = append(revisions, revision)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// SetIf sets the document only if its current revision is the given revision,
+// revision 0 means the document should not exist
+func (bolt *BoltStore) SetIf(ctx context.Context, doc Document, revision int64) (int64, error) {
+	if !doc.valid() {
+		return 0, errors.New("invalid key")
+	}
+
+	var newRevision int64
+	err := bolt.db.Update(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		current, _, err := bolt.getLiveDocument(tx, doc.DocKey)
+		if err != nil {
+			return err
+		}
+
+		if current.Revision != revision {
+			return ErrRevisionMismatch
+		}
+
+		newRevision, err = bolt.write(tx, doc, current)
+		return err
+	})
+	return newRevision, err
+}
+
+// write writes the document as the revision after the current one that is zero if it doesn't exist or it is expired,
+// it keeps the created time of the current one and records the revision in the history in the same transaction.
+// A new document continues from the expired document of its key or the tombstone of its project
+func (bolt *BoltStore) write(tx *bbolt.Tx, doc Document, current boltDocument) (int64, error) {
+	revision := current.Revision + 1
+
+	now := bolt.now().UnixNano()
+	createdAt := now
+	if current.Revision > 0 {
+		createdAt = current.CreatedAt
+	} else {
+		last, err := lastRevision(tx, doc.DocKey)
+		if err != nil {
+			return 0, err
+		}
+		revision = last + 1
+
+		// an expired document leaves its history until it is replaced or swept
+		if err := deleteNestedBucket(tx.Bucket(boltHistoryBucket), doc.Pk, doc.Project, doc.Key); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := deleteStoredExpiry(tx, doc.DocKey); err != nil {
+		return 0, err
+	}
+
+	if err := putExpiry(tx, doc.DocKey, unixNanos(doc.ExpiresAt)); err != nil {
+		return 0, err
+	}
+
+	value, err := json.Marshal(boltDocument{
+		Value:       doc.Value,
+		Revision:    revision,
+		IsEncrypted: doc.IsEncrypted,
+		DataVersion: doc.DataVersion,
+		CreatedAt:   createdAt,
+		UpdatedAt:   now,
+		ExpiresAt:   unixNanos(doc.ExpiresAt),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	project, err := createNestedBucket(tx.Bucket(boltDocumentsBucket), doc.Pk, doc.Project)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := project.Put([]byte(doc.Key), value); err != nil {
+		return 0, err
+	}
+
+	history, err := createNestedBucket(tx.Bucket(boltHistoryBucket), doc.Pk, doc.Project, doc.Key)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := history.Put(encodeUint(uint64(revision)), value); err != nil {
+		return 0, err
+	}
+
+	// revisions are big endian encoded so the cursor walks them from the oldest
+	var pruned [][]byte
+	cursor := history.Cursor()
+	for k, _ := cursor.First(); k != nil && int64(binary.BigEndian.Uint64(k)) <= revision-int64(bolt.historyLimit); k, _ = cursor.Next() {
+		pruned = append(pruned, k)
+	}
+
+	for _, k := range pruned {
+		if err := history.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+
+	return revision, nil
+}
+
+// Get gets the document of the given key
+func (bolt *BoltStore) Get(ctx context.Context, key DocKey) (Document, error) {
+	if !key.valid() {
+		return Document{}, errors.New("invalid key")
+	}
+
+	var doc Document
+	err := bolt.db.View(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		stored, found, err := bolt.getLiveDocument(tx, key)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return ErrNotExists
+		}
+
+		doc = stored.document(key)
+		return nil
+	})
+	if err != nil {
+		return Document{}, err
+	}
+	return doc, nil
+}
+
+// GetRevision gets the given revision of the document from its history
+func (bolt *BoltStore) GetRevision(ctx context.Context, key DocKey, revision int64) (Document, error) {
+	if !key.valid() {
+		return Document{}, errors.New("invalid key")
+	}
+
+	var doc Document
+	err := bolt.db.View(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, found, err := bolt.getLiveDocument(tx, key)
+		if err != nil {
+			return err
+		}
+
+		history := nestedBucket(tx.Bucket(boltHistoryBucket), key.Pk, key.Project, key.Key)
+		if !found || history == nil || revision <= 0 {
+			return ErrNotExists
+		}
+
+		value := history.Get(encodeUint(uint64(revision)))
+		if value == nil {
+			return ErrNotExists
+		}
+
+		var stored boltDocument
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return err
+		}
+
+		doc = stored.document(key)
+		return nil
+	})
+	if err != nil {
+		return Document{}, err
+	}
+	return doc, nil
+}
+
+// History gets the kept revisions of the document, the latest revision first
+func (bolt *BoltStore) History(ctx context.Context, key DocKey) ([]Document, error) {
+	if !key.valid() {
+		return nil, errors.New("invalid key")
+	}
+
+	docs := []Document{}
+	err := bolt.db.View(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, found, err := bolt.getLiveDocument(tx, key)
+		if err != nil {
+			return err
+		}
+
+		history := nestedBucket(tx.Bucket(boltHistoryBucket), key.Pk, key.Project, key.Key)
+		if !found || history == nil {
+			return nil
+		}
+
+		cursor := history.Cursor()
+		for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+			var stored boltDocument
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+
+			docs = append(docs, stored.document(key))
+		}
+		return nil
+	})
+	return docs, err
+}
+
+// Update updates the value of an existing document
+func (bolt *BoltStore) Update(ctx context.Context, key DocKey, value string) error {
+	if !key.valid() {
+		return errors.New("invalid updated ID")
+	}
+
+	return bolt.db.Update(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		current, found, err := bolt.getLiveDocument(tx, key)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return ErrSetFailed
+		}
+
+		doc := current.document(key)
+		doc.Value = value
+		_, err = bolt.write(tx, doc, current)
+		return err
+	})
+}
+
+// Delete deletes the document of the given key with its history
+func (bolt *BoltStore) Delete(ctx context.Context, key DocKey) error {
+	if !key.valid() {
+		return errors.New("invalid key")
+	}
+
+	return bolt.db.Update(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		current, found, err := bolt.getLiveDocument(tx, key)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return ErrDeleteFailed
+		}
+
+		return deleteBoltDocument(tx, key, current)
+	})
+}
+
+// DeleteProject deletes all documents of the given project with their history in one transaction
+func (bolt *BoltStore) DeleteProject(ctx context.Context, pk string, project string) error {
+	if pk == "" || project == "" {
+		return errors.New("invalid project")
+	}
+
+	return bolt.db.Update(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if projectBucket := nestedBucket(tx.Bucket(boltDocumentsBucket), pk, project); projectBucket != nil {
+			err := projectBucket.ForEach(func(key, value []byte) error {
+				var stored boltDocument
+				if err := json.Unmarshal(value, &stored); err != nil {
+					return err
+				}
+
+				docKey := DocKey{Pk: pk, Project: project, Key: string(key)}
+				if err := deleteExpiry(tx, docKey, stored.ExpiresAt); err != nil {
+					return err
+				}
+
+				return putTombstone(tx, docKey, stored.Revision)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := deleteNestedBucket(tx.Bucket(boltDocumentsBucket), pk, project); err != nil {
+			return err
+		}
+
+		return deleteNestedBucket(tx.Bucket(boltHistoryBucket), pk, project)
+	})
+}
+
+// DeleteExpired deletes the expired documents with their history in one transaction
+func (bolt *BoltStore) DeleteExpired(ctx context.Context) (int64, error) {
+	var deleted int64
+	err := bolt.db.Update(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		expired, err := expiredKeys(tx, bolt.now())
+		if err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			stored, found, err := getBoltDocument(tx, key)
+			if err != nil {
+				return err
+			}
+
+			if !found {
+				return fmt.Errorf("expired document %+v is indexed but not stored", key)
+			}
+
+			if err := deleteBoltDocument(tx, key, stored); err != nil {
+				return err
+			}
+		}
+
+		deleted = int64(len(expired))
+		return nil
+	})
+	return deleted, err
+}
+
+// expiredKeys gets the keys of the documents expired at the given time from the start of the expiry index,
+// they are collected first as buckets can't be changed while they are walked
+func expiredKeys(tx *bbolt.Tx, now time.Time) ([]DocKey, error) {
+	var expired []DocKey
+	cursor := tx.Bucket(boltExpiryBucket).Cursor()
+	for k, _ := cursor.First(); k != nil && int64(binary.BigEndian.Uint64(k[:8])) <= now.UnixNano(); k, _ = cursor.Next() {
+		var key DocKey
+		if err := json.Unmarshal(k[8:], &key); err != nil {
+			return nil, err
+		}
+
+		expired = append(expired, key)
+	}
+	return expired, nil
+}
+
+// expiryKey gets the key of the document in the expiry index
+func expiryKey(key DocKey, expiresAt int64) ([]byte, error) {
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	return append(encodeUint(uint64(expiresAt)), encoded...), nil
+}
+
+// putExpiry adds the document to the expiry index if it expires
+func putExpiry(tx *bbolt.Tx, key DocKey, expiresAt int64) error {
+	if expiresAt == 0 {
+		return nil
+	}
+
+	k, err := expiryKey(key, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltExpiryBucket).Put(k, nil)
+}
+
+// deleteExpiry removes the document from the expiry index if it expires
+func deleteExpiry(tx *bbolt.Tx, key DocKey, expiresAt int64) error {
+	if expiresAt == 0 {
+		return nil
+	}
+
+	k, err := expiryKey(key, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltExpiryBucket).Delete(k)
+}
+
+// deleteStoredExpiry removes the stored document of the given key from the expiry index before it is replaced
+func deleteStoredExpiry(tx *bbolt.Tx, key DocKey) error {
+	stored, found, err := getBoltDocument(tx, key)
+	if err != nil || !found {
+		return err
+	}
+	return deleteExpiry(tx, key, stored.ExpiresAt)
+}
+
+// List gets all keys
+func (bolt *BoltStore) List(ctx context.Context) ([]DocKey, error) {
+	var all []DocKey
+	err := bolt.db.View(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		now := bolt.now()
+		return forEachBoltDocument(tx, func(key DocKey, stored boltDocument) {
+			if !stored.metadata().expired(now) {
+				all = append(all, key)
+			}
+		})
+	})
+	return all, err
+}
+
+// forEachBoltDocument calls fn with each stored document
+func forEachBoltDocument(tx *bbolt.Tx, fn func(DocKey, boltDocument)) error {
+	documents := tx.Bucket(boltDocumentsBucket)
+	return documents.ForEach(func(pk, _ []byte) error {
+		pkBucket := documents.Bucket(pk)
+		return pkBucket.ForEach(func(project, _ []byte) error {
+			return pkBucket.Bucket(project).ForEach(func(key, value []byte) error {
+				var stored boltDocument
+				if err := json.Unmarshal(value, &stored); err != nil {
+					return err
+				}
+
+				fn(DocKey{Pk: string(pk), Project: string(project), Key: string(key)}, stored)
+				return nil
+			})
+		})
+	})
+}
+
+// Count gets the number of stored keys and of the projects that have them, the keys of each project are counted
+// from the bucket stats and the expired ones from the expiry index, so the documents are not decoded
+func (bolt *BoltStore) Count(ctx context.Context) (keys int64, projects int64, err error) {
+	err = bolt.db.View(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		projectKeys := map[[2]string]int64{}
+		documents := tx.Bucket(boltDocumentsBucket)
+		err := documents.ForEach(func(pk, _ []byte) error {
+			pkBucket := documents.Bucket(pk)
+			return pkBucket.ForEach(func(project, _ []byte) error {
+				projectKeys[[2]string{string(pk), string(project)}] = int64(pkBucket.Bucket(project).Stats().KeyN)
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		expired, err := expiredKeys(tx, bolt.now())
+		if err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			projectKeys[[2]string{key.Pk, key.Project}]--
+		}
+
+		for _, n := range projectKeys {
+			if n > 0 {
+				keys += n
+				projects++
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// ListProject gets the keys of the given project that match the options ordered by key
+func (bolt *BoltStore) ListProject(ctx context.Context, pk string, project string, opts ListOptions) ([]string, error) {
+	metadata, err := bolt.ListMetadata(ctx, pk, project, opts)
+	if err != nil {
+		return nil, err
+	}
+	return keysOf(metadata), nil
+}
+
+// ListMetadata gets the keys of the given project that match the options with their metadata ordered by key
+func (bolt *BoltStore) ListMetadata(ctx context.Context, pk string, project string, opts ListOptions) ([]KeyMetadata, error) {
+	if pk == "" || project == "" {
+		return nil, errors.New("invalid project")
+	}
+
+	metadata := []KeyMetadata{}
+	err := bolt.db.View(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		projectBucket := nestedBucket(tx.Bucket(boltDocumentsBucket), pk, project)
+		if projectBucket == nil {
+			return nil
+		}
+
+		now := bolt.now()
+
+		// keys are sorted, so the listed keys start from the prefix or the key after opts.After
+		start := opts.Prefix
+		if opts.After > start {
+			start = opts.After
+		}
+
+		cursor := projectBucket.Cursor()
+		for k, v := cursor.Seek([]byte(start)); k != nil; k, v = cursor.Next() {
+			if opts.Limit > 0 && len(metadata) == opts.Limit {
+				break
+			}
+
+			key := string(k)
+			if !strings.HasPrefix(key, opts.Prefix) {
+				break
+			}
+
+			if !opts.includes(key) {
+				continue
+			}
+
+			var stored boltDocument
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+
+			if stored.metadata().expired(now) {
+				continue
+			}
+
+			metadata = append(metadata, KeyMetadata{Key: key, Revision: stored.Revision, Metadata: stored.metadata()})
+		}
+		return nil
+	})
+	return metadata, err
+}
+
+// Usage gets the storage used by each project of the public key, ordered by project
+func (bolt *BoltStore) Usage(ctx context.Context, pk string) ([]ProjectUsage, error) {
+	if pk == "" {
+		return nil, errors.New("invalid public key")
+	}
+
+	usage := []ProjectUsage{}
+	err := bolt.db.View(func(tx *bbolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		pkBucket := nestedBucket(tx.Bucket(boltDocumentsBucket), pk)
+		if pkBucket == nil {
+			return nil
+		}
+
+		now := bolt.now()
+		return pkBucket.ForEach(func(name, _ []byte) error {
+			project := ProjectUsage{Project: string(name)}
+			err := pkBucket.Bucket(name).ForEach(func(_, value []byte) error {
+				var stored boltDocument
+				if err := json.Unmarshal(value, &stored); err != nil {
+					return err
+				}
+
+				if !stored.metadata().expired(now) {
+					project.Keys++
+					project.Bytes += int64(len(stored.Value))
+				}
+				return nil
+			})
+
+			if project.Keys > 0 {
+				usage = append(usage, project)
+			}
+			return err
+		})
+	})
+	return usage, err
+}
+
+// deleteBoltDocument deletes the stored document of the given key with its history,
+// and raises the tombstone of its project to its revision
+func deleteBoltDocument(tx *bbolt.Tx, key DocKey, stored boltDocument) error {
+	if err := putTombstone(tx, key, stored.Revision); err != nil {
+		return err
+	}
+
+	if err := deleteExpiry(tx, key, stored.ExpiresAt); err != nil {
+		return err
+	}
+
+	documents := tx.Bucket(boltDocumentsBucket)
+	if err := nestedBucket(documents, key.Pk, key.Project).Delete([]byte(key.Key)); err != nil {
+		return err
+	}
+
+	if err := deleteNestedBucket(tx.Bucket(boltHistoryBucket), key.Pk, key.Project, key.Key); err != nil {
+		return err
+	}
+
+	return pruneEmptyBuckets(documents, key.Pk, key.Project)
+}
+
+// putTombstone raises the tombstone of the project of the given key to the revision of its deleted document
+func putTombstone(tx *bbolt.Tx, key DocKey, revision int64) error {
+	if revision <= projectTombstone(tx, key) {
+		return nil
+	}
+
+	pk, err := createNestedBucket(tx.Bucket(boltTombstonesBucket), key.Pk)
+	if err != nil {
+		return err
+	}
+
+	return pk.Put([]byte(key.Project), encodeUint(uint64(revision)))
+}
+
+// projectTombstone gets the highest revision of the deleted documents of the project of the given key,
+// 0 if there is none
+func projectTombstone(tx *bbolt.Tx, key DocKey) int64 {
+	pk := nestedBucket(tx.Bucket(boltTombstonesBucket), key.Pk)
+	if pk == nil {
+		return 0
+	}
+
+	value := pk.Get([]byte(key.Project))
+	if value == nil {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(value))
+}
+
+// lastRevision gets the last revision of the key that is written as a new document, it is the highest of
+// the revision of the expired document that is replaced and the tombstone of its project
+func lastRevision(tx *bbolt.Tx, key DocKey) (int64, error) {
+	expired, _, err := getBoltDocument(tx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if tombstone := projectTombstone(tx, key); tombstone > expired.Revision {
+		return tombstone, nil
+	}
+
+	return expired.Revision, nil
+}
+
+// getBoltDocument gets the stored document of the given key, found is false if it doesn't exist
+func getBoltDocument(tx *bbolt.Tx, key DocKey) (doc boltDocument, found bool, err error) {
+	project := nestedBucket(tx.Bucket(boltDocumentsBucket), key.Pk, key.Project)
+	if project == nil {
+		return
+	}
+
+	value := project.Get([]byte(key.Key))
+	if value == nil {
+		return
+	}
+
+	return doc, true, json.Unmarshal(value, &doc)
+}
+
+// getLiveDocument gets the stored document of the given key, found is false if it doesn't exist or it is expired
+func (bolt *BoltStore) getLiveDocument(tx *bbolt.Tx, key DocKey) (boltDocument, bool, error) {
+	doc, found, err := getBoltDocument(tx, key)
+	if err != nil || !found || doc.metadata().expired(bolt.now()) {
+		return boltDocument{}, false, err
+	}
+	return doc, true, nil
+}
+
+// nestedBucket gets the bucket of the given names path under the root bucket, nil if it doesn't exist
+func nestedBucket(root *bbolt.Bucket, names ...string) *bbolt.Bucket {
+	bucket := root
+	for _, name := range names {
+		if bucket = bucket.Bucket([]byte(name)); bucket == nil {
+			return nil
+		}
+	}
+	return bucket
+}
+
+// createNestedBucket gets the bucket of the given names path under the root bucket, creating the missing ones
+func createNestedBucket(root *bbolt.Bucket, names ...string) (*bbolt.Bucket, error) {
+	bucket := root
+	for _, name := range names {
+		var err error
+		if bucket, err = bucket.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return nil, err
+		}
+	}
+	return bucket, nil
+}
+
+// deleteNestedBucket deletes the last bucket of the given names path if it exists,
+// then the parents that are left empty
+func deleteNestedBucket(root *bbolt.Bucket, names ...string) error {
+	parents := names[:len(names)-1]
+	parent := nestedBucket(root, parents...)
+	if parent == nil {
+		return nil
+	}
+
+	err := parent.DeleteBucket([]byte(names[len(names)-1]))
+	if err != nil && !errors.Is(err, bbolt.ErrBucketNotFound) {
+		return err
+	}
+
+	return pruneEmptyBuckets(root, parents...)
+}
+
+// pruneEmptyBuckets deletes the buckets of the given names path that are empty, starting from the deepest
+func pruneEmptyBuckets(root *bbolt.Bucket, names ...string) error {
+	for i := len(names); i > 0; i-- {
+		bucket := nestedBucket(root, names[:i]...)
+		if bucket == nil {
+			continue
+		}
+
+		if k, _ := bucket.Cursor().First(); k != nil {
+			return nil
+		}
+
+		if err := nestedBucket(root, names[:i-1]...).DeleteBucket([]byte(names[i-1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeUint encodes the number in big endian, so the encoded numbers sort as the numbers
+func encodeUint(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b
+}
@@ -0,0 +1,202 @@
+// package store is for pkid storage
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestBoltStore(t *testing.T) {
+	ctx := context.Background()
+	pkidStore := NewBoltStore()
+	t.Run("test_empty_conn", func(t *testing.T) {
+		err := pkidStore.SetConn("")
+
+		if err == nil {
+			t.Errorf("connection should not be set")
+		}
+	})
+
+	testPkidStore(t, pkidStore, t.TempDir()+"/pkid.bolt")
+	testPkidStoreHistory(t, pkidStore)
+
+	t.Run("test_delete_prunes_buckets", func(t *testing.T) {
+		key := DocKey{Pk: "prune", Project: "project", Key: "key"}
+		if _, err := pkidStore.Set(ctx, Document{DocKey: key, Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := pkidStore.Delete(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+
+		err := pkidStore.db.View(func(tx *bbolt.Tx) error {
+			if tx.Bucket(boltDocumentsBucket).Bucket([]byte(key.Pk)) != nil {
+				t.Errorf("empty pk bucket should be deleted")
+			}
+
+			if tx.Bucket(boltHistoryBucket).Bucket([]byte(key.Pk)) != nil {
+				t.Errorf("empty pk history bucket should be deleted")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestBoltMigrateEnvelopes(t *testing.T) {
+	ctx := context.Background()
+	dbFile := t.TempDir() + "/pkid.bolt"
+
+	db, err := bbolt.Open(dbFile, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the schema before the envelope metadata, history revisions are raw values
+	value := signedEnvelope(`{"is_encrypted": true, "payload": "value", "data_version": 1}`)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucket(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+
+		if err := meta.Put(boltVersionKey, encodeUint(1)); err != nil {
+			return err
+		}
+
+		if err := createBoltBuckets(tx); err != nil {
+			return err
+		}
+
+		project, err := createNestedBucket(tx.Bucket(boltDocumentsBucket), "pk", "project")
+		if err != nil {
+			return err
+		}
+
+		if err := project.Put([]byte("key"), []byte(`{"value": "`+value+`", "revision": 1}`)); err != nil {
+			return err
+		}
+
+		history, err := createNestedBucket(tx.Bucket(boltHistoryBucket), "pk", "project", "key")
+		if err != nil {
+			return err
+		}
+
+		return history.Put(encodeUint(1), []byte(value))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	pkidStore := NewBoltStore()
+	if err := pkidStore.SetConn(dbFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if migrated, err := pkidStore.Migrated(ctx); err != nil || migrated {
+		t.Errorf("database should not be migrated yet: %v", err)
+	}
+
+	if err := pkidStore.Migrate(ctx); err != nil {
+		t.Fatalf("migration should succeed: %v", err)
+	}
+
+	if migrated, err := pkidStore.Migrated(ctx); err != nil || !migrated {
+		t.Errorf("database should be migrated: %v", err)
+	}
+
+	envelope := Envelope{IsEncrypted: true, DataVersion: 1}
+	doc, err := pkidStore.Get(ctx, DocKey{Pk: "pk", Project: "project", Key: "key"})
+	if err != nil || doc.Envelope != envelope || doc.Value != value {
+		t.Errorf("envelope should be read from the value, got %+v: %v", doc, err)
+	}
+
+	docs, err := pkidStore.History(ctx, DocKey{Pk: "pk", Project: "project", Key: "key"})
+	if err != nil || len(docs) != 1 || docs[0].Envelope != envelope || docs[0].Value != value || docs[0].Revision != 1 {
+		t.Errorf("history revisions should be migrated, got %+v: %v", docs, err)
+	}
+}
+
+func TestBoltMigrateExpiryIndex(t *testing.T) {
+	ctx := context.Background()
+	dbFile := t.TempDir() + "/pkid.bolt"
+
+	db, err := bbolt.Open(dbFile, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the schema before the expiry index, with a document that expires and one that doesn't
+	now := time.Now()
+	err = db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucket(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+
+		if err := meta.Put(boltVersionKey, encodeUint(3)); err != nil {
+			return err
+		}
+
+		if err := createBoltBuckets(tx); err != nil {
+			return err
+		}
+
+		if err := createBoltTombstonesBucket(tx); err != nil {
+			return err
+		}
+
+		project, err := createNestedBucket(tx.Bucket(boltDocumentsBucket), "pk", "project")
+		if err != nil {
+			return err
+		}
+
+		expiring := fmt.Sprintf(`{"value": "value", "revision": 1, "expires_at": %d}`, now.Add(time.Minute).UnixNano())
+		if err := project.Put([]byte("expiring"), []byte(expiring)); err != nil {
+			return err
+		}
+
+		return project.Put([]byte("kept"), []byte(`{"value": "value", "revision": 1}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	pkidStore := NewBoltStore()
+	if err := pkidStore.SetConn(dbFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pkidStore.Migrate(ctx); err != nil {
+		t.Fatalf("migration should succeed: %v", err)
+	}
+
+	pkidStore.SetClock(func() time.Time { return now.Add(time.Hour) })
+	deleted, err := pkidStore.DeleteExpired(ctx)
+	if err != nil || deleted != 1 {
+		t.Errorf("the indexed expired document should be deleted, got %d: %v", deleted, err)
+	}
+
+	if _, err := pkidStore.Get(ctx, DocKey{Pk: "pk", Project: "project", Key: "kept"}); err != nil {
+		t.Errorf("the document that doesn't expire should be kept: %v", err)
+	}
+
+	err = pkidStore.db.View(func(tx *bbolt.Tx) error {
+		if k, _ := tx.Bucket(boltExpiryBucket).Cursor().First(); k != nil {
+			t.Errorf("the swept document should be removed from the expiry index")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
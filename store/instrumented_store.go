@@ -0,0 +1,155 @@
+// package store is for pkid storage
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Observer records the latency of store operations and whether they failed
+type Observer interface {
+	ObserveStore(driver, operation string, duration time.Duration, failed bool)
+}
+
+// InstrumentedStore is a store that reports the latency and failures of the operations of another store,
+// missing documents, deletes of missing documents and revision mismatches are expected results so they are not failures
+type InstrumentedStore struct {
+	store    PkidStore
+	driver   string
+	observer Observer
+}
+
+// NewInstrumentedStore creates a store that reports the operations of the given store of the given driver
+func NewInstrumentedStore(store PkidStore, driver string, observer Observer) *InstrumentedStore {
+	return &InstrumentedStore{store: store, driver: driver, observer: observer}
+}
+
+// observe reports an operation that started at the given time
+func (s *InstrumentedStore) observe(operation string, start time.Time, err error) {
+	failed := err != nil && !errors.Is(err, ErrNotExists) && !errors.Is(err, ErrDeleteFailed) && !errors.Is(err, ErrRevisionMismatch)
+	s.observer.ObserveStore(s.driver, operation, time.Since(start), failed)
+}
+
+// SetConn sets the connection of the store
+func (s *InstrumentedStore) SetConn(conn string) error {
+	return s.store.SetConn(conn)
+}
+
+// SetHistoryLimit sets how many revisions of each document are kept, including the current one
+func (s *InstrumentedStore) SetHistoryLimit(limit int) {
+	s.store.SetHistoryLimit(limit)
+}
+
+// SetClock sets the clock of the write times and expiry of documents
+func (s *InstrumentedStore) SetClock(now func() time.Time) {
+	s.store.SetClock(now)
+}
+
+// Migrate migrates the store
+func (s *InstrumentedStore) Migrate(ctx context.Context) (err error) {
+	defer func(start time.Time) { s.observe("migrate", start, err) }(time.Now())
+	return s.store.Migrate(ctx)
+}
+
+// Ping checks that the database is reachable
+func (s *InstrumentedStore) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { s.observe("ping", start, err) }(time.Now())
+	return s.store.Ping(ctx)
+}
+
+// Migrated checks that all migrations of the store are applied
+func (s *InstrumentedStore) Migrated(ctx context.Context) (migrated bool, err error) {
+	defer func(start time.Time) { s.observe("migrated", start, err) }(time.Now())
+	return s.store.Migrated(ctx)
+}
+
+// Get gets the document of the given key
+func (s *InstrumentedStore) Get(ctx context.Context, key DocKey) (doc Document, err error) {
+	defer func(start time.Time) { s.observe("get", start, err) }(time.Now())
+	return s.store.Get(ctx, key)
+}
+
+// GetRevision gets a kept revision of the document of the given key
+func (s *InstrumentedStore) GetRevision(ctx context.Context, key DocKey, revision int64) (doc Document, err error) {
+	defer func(start time.Time) { s.observe("get_revision", start, err) }(time.Now())
+	return s.store.GetRevision(ctx, key, revision)
+}
+
+// History gets the kept revisions of the document of the given key, the latest revision first
+func (s *InstrumentedStore) History(ctx context.Context, key DocKey) (docs []Document, err error) {
+	defer func(start time.Time) { s.observe("history", start, err) }(time.Now())
+	return s.store.History(ctx, key)
+}
+
+// Set writes the document and returns its new revision
+func (s *InstrumentedStore) Set(ctx context.Context, doc Document) (revision int64, err error) {
+	defer func(start time.Time) { s.observe("set", start, err) }(time.Now())
+	return s.store.Set(ctx, doc)
+}
+
+// SetIf writes the document only if its current revision is the given revision
+func (s *InstrumentedStore) SetIf(ctx context.Context, doc Document, expected int64) (revision int64, err error) {
+	defer func(start time.Time) { s.observe("set_if", start, err) }(time.Now())
+	return s.store.SetIf(ctx, doc, expected)
+}
+
+// SetMany writes the documents in one transaction
+func (s *InstrumentedStore) SetMany(ctx context.Context, docs []Document) (revisions []int64, err error) {
+	defer func(start time.Time) { s.observe("set_many", start, err) }(time.Now())
+	return s.store.SetMany(ctx, docs)
+}
+
+// Update updates the value of the document of the given key
+func (s *InstrumentedStore) Update(ctx context.Context, key DocKey, value string) (err error) {
+	defer func(start time.Time) { s.observe("update", start, err) }(time.Now())
+	return s.store.Update(ctx, key, value)
+}
+
+// Delete deletes the document of the given key with its history
+func (s *InstrumentedStore) Delete(ctx context.Context, key DocKey) (err error) {
+	defer func(start time.Time) { s.observe("delete", start, err) }(time.Now())
+	return s.store.Delete(ctx, key)
+}
+
+// DeleteProject deletes the documents of a project with their history
+func (s *InstrumentedStore) DeleteProject(ctx context.Context, pk string, project string) (err error) {
+	defer func(start time.Time) { s.observe("delete_project", start, err) }(time.Now())
+	return s.store.DeleteProject(ctx, pk, project)
+}
+
+// DeleteExpired deletes the expired documents with their history
+func (s *InstrumentedStore) DeleteExpired(ctx context.Context) (deleted int64, err error) {
+	defer func(start time.Time) { s.observe("delete_expired", start, err) }(time.Now())
+	return s.store.DeleteExpired(ctx)
+}
+
+// List lists the keys of all documents
+func (s *InstrumentedStore) List(ctx context.Context) (keys []DocKey, err error) {
+	defer func(start time.Time) { s.observe("list", start, err) }(time.Now())
+	return s.store.List(ctx)
+}
+
+// Count counts the stored keys and projects
+func (s *InstrumentedStore) Count(ctx context.Context) (keys int64, projects int64, err error) {
+	defer func(start time.Time) { s.observe("count", start, err) }(time.Now())
+	return s.store.Count(ctx)
+}
+
+// ListProject lists the keys of the documents of a project that match the options
+func (s *InstrumentedStore) ListProject(ctx context.Context, pk string, project string, opts ListOptions) (keys []string, err error) {
+	defer func(start time.Time) { s.observe("list_project", start, err) }(time.Now())
+	return s.store.ListProject(ctx, pk, project, opts)
+}
+
+// ListMetadata lists the keys of the documents of a project that match the options with their metadata
+func (s *InstrumentedStore) ListMetadata(ctx context.Context, pk string, project string, opts ListOptions) (metadata []KeyMetadata, err error) {
+	defer func(start time.Time) { s.observe("list_metadata", start, err) }(time.Now())
+	return s.store.ListMetadata(ctx, pk, project, opts)
+}
+
+// Usage gets the storage used by each project of the public key
+func (s *InstrumentedStore) Usage(ctx context.Context, pk string) (usage []ProjectUsage, err error) {
+	defer func(start time.Time) { s.observe("usage", start, err) }(time.Now())
+	return s.store.Usage(ctx, pk)
+}
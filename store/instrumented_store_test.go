@@ -0,0 +1,71 @@
+// package store is for pkid storage
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeObserver counts the observed operations and failures
+type fakeObserver struct {
+	mutex      sync.Mutex
+	operations map[string]int
+	failures   map[string]int
+}
+
+func (o *fakeObserver) ObserveStore(driver, operation string, duration time.Duration, failed bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.operations[driver+":"+operation]++
+	if failed {
+		o.failures[driver+":"+operation]++
+	}
+}
+
+func TestInstrumentedStore(t *testing.T) {
+	ctx := context.Background()
+	observer := &fakeObserver{operations: map[string]int{}, failures: map[string]int{}}
+	pkidStore := NewInstrumentedStore(NewMemoryStore(), "memory", observer)
+
+	testPkidStore(t, pkidStore, "")
+	testPkidStoreHistory(t, pkidStore)
+
+	t.Run("test_observed_operations", func(t *testing.T) {
+		observer.operations = map[string]int{}
+		observer.failures = map[string]int{}
+
+		key := DocKey{Pk: "observed", Project: "project", Key: "key"}
+		if _, err := pkidStore.Set(ctx, Document{DocKey: key, Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := pkidStore.SetIf(ctx, Document{DocKey: key, Value: "value"}, 5); err != ErrRevisionMismatch {
+			t.Errorf("set should fail with revision mismatch: %v", err)
+		}
+
+		if _, err := pkidStore.Get(ctx, DocKey{Pk: "observed", Project: "project", Key: "missing"}); err == nil {
+			t.Errorf("missing key should not be found")
+		}
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := pkidStore.Get(canceled, key); err == nil {
+			t.Errorf("get should fail with a canceled context")
+		}
+
+		if observer.operations["memory:set"] != 1 || observer.operations["memory:set_if"] != 1 || observer.operations["memory:get"] != 2 {
+			t.Errorf("all operations should be observed, got %v", observer.operations)
+		}
+
+		if observer.failures["memory:set_if"] != 0 {
+			t.Errorf("revision mismatch should not be a failure")
+		}
+
+		if observer.failures["memory:get"] != 1 {
+			t.Errorf("only the canceled get should be a failure, got %d", observer.failures["memory:get"])
+		}
+	})
+}
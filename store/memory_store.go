@@ -0,0 +1,447 @@
+// package store is for pkid storage
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a thread safe in-memory store, its data is lost when the process stops
+type MemoryStore struct {
+	mutex        sync.RWMutex
+	docs         map[DocKey]Document
+	history      map[DocKey][]Document
+	historyLimit int
+	now          func() time.Time
+	// tombstones are the highest revisions of the deleted documents of each pk and project,
+	// the documents created later in the project continue from them
+	tombstones map[[2]string]int64
+}
+
+// NewMemoryStore creates a new instance of the in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		docs:         map[DocKey]Document{},
+		history:      map[DocKey][]Document{},
+		tombstones:   map[[2]string]int64{},
+		historyLimit: DefaultHistoryLimit,
+		now:          time.Now,
+	}
+}
+
+// SetConn is a no-op, the in-memory store has no connection
+func (memory *MemoryStore) SetConn(string) error {
+	return nil
+}
+
+// SetHistoryLimit sets how many revisions of each document are kept, including the current one
+func (memory *MemoryStore) SetHistoryLimit(limit int) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	memory.historyLimit = limit
+}
+
+// SetClock sets the clock of the write times and expiry of documents
+func (memory *MemoryStore) SetClock(now func() time.Time) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	memory.now = now
+}
+
+// live gets the document of the given key if it exists and it is not expired, the lock should be held
+func (memory *MemoryStore) live(key DocKey) (Document, bool) {
+	doc, ok := memory.docs[key]
+	if !ok || doc.expired(memory.now()) {
+		return Document{}, false
+	}
+	return doc, true
+}
+
+// Migrate is a no-op, the in-memory store has no schema
+func (memory *MemoryStore) Migrate(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Ping is a no-op, the in-memory store is always reachable
+func (memory *MemoryStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Migrated is always true, the in-memory store has no schema
+func (memory *MemoryStore) Migrated(ctx context.Context) (bool, error) {
+	return true, ctx.Err()
+}
+
+// Set adds a new document or updates the existing one and increases its revision
+func (memory *MemoryStore) Set(ctx context.Context, doc Document) (int64, error) {
+	if !doc.valid() {
+		return 0, errors.New("invalid key")
+	}
+
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return memory.write(doc), nil
+}
+
+// SetMany adds or updates all documents at once, readers don't see a part of them
+func (memory *MemoryStore) SetMany(ctx context.Context, docs []Document) ([]int64, error) {
+	for _, doc := range docs {
+		if !doc.valid() {
+			return nil, errors.New("invalid key")
+		}
+	}
+
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	revisions := make([]int64, 0, len(docs))
+	for _, doc := range docs {
+		revisions = append(revisions, memory.write(doc))
+	}
+
+	return revisions, nil
+}
+
+// SetIf sets the document only if its current revision is the given revision,
+// revision 0 means the document should not exist
+func (memory *MemoryStore) SetIf(ctx context.Context, doc Document, revision int64) (int64, error) {
+	if !doc.valid() {
+		return 0, errors.New("invalid key")
+	}
+
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if current, _ := memory.live(doc.DocKey); current.Revision != revision {
+		return 0, ErrRevisionMismatch
+	}
+
+	return memory.write(doc), nil
+}
+
+// write writes the document as the next revision and records it in the history, an expired document is replaced
+// with its history. A new document continues from the tombstone of its project, so its revisions are never reused.
+// The lock should be held
+func (memory *MemoryStore) write(doc Document) int64 {
+	now := memory.now().UTC()
+	current, ok := memory.live(doc.DocKey)
+	if _, expired := memory.docs[doc.DocKey]; expired && !ok {
+		memory.remove(doc.DocKey)
+	}
+
+	doc.Metadata = Metadata{CreatedAt: now, UpdatedAt: now, Size: int64(len(doc.Value)), ExpiresAt: doc.ExpiresAt}
+	if ok {
+		doc.CreatedAt = current.CreatedAt
+		doc.Revision = current.Revision + 1
+	} else {
+		doc.Revision = memory.tombstones[[2]string{doc.Pk, doc.Project}] + 1
+	}
+
+	memory.docs[doc.DocKey] = doc
+
+	history := append(memory.history[doc.DocKey], doc)
+	if len(history) > memory.historyLimit {
+		history = history[len(history)-memory.historyLimit:]
+	}
+	memory.history[doc.DocKey] = history
+
+	return doc.Revision
+}
+
+// Get gets the document of the given key
+func (memory *MemoryStore) Get(ctx context.Context, key DocKey) (Document, error) {
+	if !key.valid() {
+		return Document{}, errors.New("invalid key")
+	}
+
+	memory.mutex.RLock()
+	defer memory.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
+
+	doc, ok := memory.live(key)
+	if !ok {
+		return Document{}, ErrNotExists
+	}
+	return doc, nil
+}
+
+// GetRevision gets the given revision of the document from its history
+func (memory *MemoryStore) GetRevision(ctx context.Context, key DocKey, revision int64) (Document, error) {
+	if !key.valid() {
+		return Document{}, errors.New("invalid key")
+	}
+
+	memory.mutex.RLock()
+	defer memory.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
+
+	if _, ok := memory.live(key); !ok {
+		return Document{}, ErrNotExists
+	}
+
+	for _, doc := range memory.history[key] {
+		if doc.Revision == revision {
+			return doc, nil
+		}
+	}
+	return Document{}, ErrNotExists
+}
+
+// History gets the kept revisions of the document, the latest revision first
+func (memory *MemoryStore) History(ctx context.Context, key DocKey) ([]Document, error) {
+	if !key.valid() {
+		return nil, errors.New("invalid key")
+	}
+
+	memory.mutex.RLock()
+	defer memory.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := memory.live(key); !ok {
+		return []Document{}, nil
+	}
+
+	history := memory.history[key]
+	docs := make([]Document, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		docs = append(docs, history[i])
+	}
+	return docs, nil
+}
+
+// Update updates the value of an existing document
+func (memory *MemoryStore) Update(ctx context.Context, key DocKey, value string) error {
+	if !key.valid() {
+		return errors.New("invalid updated ID")
+	}
+
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	current, ok := memory.live(key)
+	if !ok {
+		return ErrSetFailed
+	}
+
+	memory.write(Document{DocKey: key, Envelope: current.Envelope, Metadata: Metadata{ExpiresAt: current.ExpiresAt}, Value: value})
+	return nil
+}
+
+// Delete deletes the document of the given key with its history
+func (memory *MemoryStore) Delete(ctx context.Context, key DocKey) error {
+	if !key.valid() {
+		return errors.New("invalid key")
+	}
+
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, ok := memory.live(key); !ok {
+		return ErrDeleteFailed
+	}
+
+	memory.remove(key)
+	return nil
+}
+
+// remove deletes the document of the given key with its history and raises the tombstone of its project
+// to its revision, the lock should be held
+func (memory *MemoryStore) remove(key DocKey) {
+	project := [2]string{key.Pk, key.Project}
+	if revision := memory.docs[key].Revision; revision > memory.tombstones[project] {
+		memory.tombstones[project] = revision
+	}
+	delete(memory.docs, key)
+	delete(memory.history, key)
+}
+
+// DeleteProject deletes all documents of the given project with their history
+func (memory *MemoryStore) DeleteProject(ctx context.Context, pk string, project string) error {
+	if pk == "" || project == "" {
+		return errors.New("invalid project")
+	}
+
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for key := range memory.docs {
+		if key.Pk == pk && key.Project == project {
+			memory.remove(key)
+		}
+	}
+	return nil
+}
+
+// DeleteExpired deletes the expired documents with their history
+func (memory *MemoryStore) DeleteExpired(ctx context.Context) (int64, error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	now := memory.now()
+	var deleted int64
+	for key, doc := range memory.docs {
+		if doc.expired(now) {
+			memory.remove(key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// List gets all keys
+func (memory *MemoryStore) List(ctx context.Context) ([]DocKey, error) {
+	memory.mutex.RLock()
+	defer memory.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	now := memory.now()
+	var all []DocKey
+	for key, doc := range memory.docs {
+		if !doc.expired(now) {
+			all = append(all, key)
+		}
+	}
+	return all, nil
+}
+
+// Count gets the number of stored keys and of the projects that have them
+func (memory *MemoryStore) Count(ctx context.Context) (int64, int64, error) {
+	memory.mutex.RLock()
+	defer memory.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	now := memory.now()
+	var keys int64
+	projects := map[[2]string]bool{}
+	for key, doc := range memory.docs {
+		if !doc.expired(now) {
+			keys++
+			projects[[2]string{key.Pk, key.Project}] = true
+		}
+	}
+	return keys, int64(len(projects)), nil
+}
+
+// ListProject gets the keys of the given project that match the options ordered by key
+func (memory *MemoryStore) ListProject(ctx context.Context, pk string, project string, opts ListOptions) ([]string, error) {
+	metadata, err := memory.ListMetadata(ctx, pk, project, opts)
+	if err != nil {
+		return nil, err
+	}
+	return keysOf(metadata), nil
+}
+
+// ListMetadata gets the keys of the given project that match the options with their metadata ordered by key
+func (memory *MemoryStore) ListMetadata(ctx context.Context, pk string, project string, opts ListOptions) ([]KeyMetadata, error) {
+	if pk == "" || project == "" {
+		return nil, errors.New("invalid project")
+	}
+
+	memory.mutex.RLock()
+	defer memory.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	now := memory.now()
+	metadata := []KeyMetadata{}
+	for key, doc := range memory.docs {
+		if key.Pk == pk && key.Project == project && opts.includes(key.Key) && !doc.expired(now) {
+			metadata = append(metadata, KeyMetadata{Key: key.Key, Revision: doc.Revision, Metadata: doc.Metadata})
+		}
+	}
+	sort.Slice(metadata, func(i, j int) bool { return metadata[i].Key < metadata[j].Key })
+
+	if opts.Limit > 0 && len(metadata) > opts.Limit {
+		metadata = metadata[:opts.Limit]
+	}
+	return metadata, nil
+}
+
+// Usage gets the storage used by each project of the public key, ordered by project
+func (memory *MemoryStore) Usage(ctx context.Context, pk string) ([]ProjectUsage, error) {
+	if pk == "" {
+		return nil, errors.New("invalid public key")
+	}
+
+	memory.mutex.RLock()
+	defer memory.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	now := memory.now()
+	projects := map[string]*ProjectUsage{}
+	for key, doc := range memory.docs {
+		if key.Pk != pk || doc.expired(now) {
+			continue
+		}
+
+		project, ok := projects[key.Project]
+		if !ok {
+			project = &ProjectUsage{Project: key.Project}
+			projects[key.Project] = project
+		}
+
+		project.Keys++
+		project.Bytes += int64(len(doc.Value))
+	}
+
+	usage := make([]ProjectUsage, 0, len(projects))
+	for _, project := range projects {
+		usage = append(usage, *project)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Project < usage[j].Project })
+	return usage, nil
+}
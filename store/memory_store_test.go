@@ -0,0 +1,41 @@
+// package store is for pkid storage
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	pkidStore := NewMemoryStore()
+	testPkidStore(t, pkidStore, "")
+	testPkidStoreHistory(t, pkidStore)
+
+	t.Run("test_concurrent_set", func(t *testing.T) {
+		key := DocKey{Pk: "concurrent", Project: "project", Key: "key"}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if _, err := pkidStore.Set(ctx, Document{DocKey: key, Value: fmt.Sprint(i)}); err != nil {
+					t.Errorf("set should succeed: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		doc, err := pkidStore.Get(ctx, key)
+		if err != nil {
+			t.Errorf("get should not fail: %v", err)
+		}
+
+		if doc.Revision != 50 {
+			t.Errorf("every set should increase the revision, got %d", doc.Revision)
+		}
+	})
+}
@@ -1,13 +1,184 @@
 // package store is for pkid storage
 package store
 
-// PkidStore an interface for pkid db store
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// DocKey identifies a document by its public key, project and key
+type DocKey struct {
+	Pk      string
+	Project string
+	Key     string
+}
+
+// valid checks that all parts of the document key are given
+func (k DocKey) valid() bool {
+	return k.Pk != "" && k.Project != "" && k.Key != ""
+}
+
+// Envelope is the metadata of the signed payload envelope of a document
+type Envelope struct {
+	IsEncrypted bool
+	// DataVersion is the version of the payload envelope, 0 means it is unknown
+	DataVersion int
+}
+
+// Metadata is the write times, size and expiry of a document, the write times and size are filled by the stores
+type Metadata struct {
+	// CreatedAt is the time of the first write, the zero time means it is unknown
+	// as the document is written before the write times are recorded
+	CreatedAt time.Time
+	// UpdatedAt is the time of the last write, the zero time means it is unknown
+	UpdatedAt time.Time
+	// Size is the number of bytes of the value
+	Size int64
+	// ExpiresAt is the time the document expires, the zero time means it never expires.
+	// Expired documents are not found, and they are deleted with their history by DeleteExpired
+	ExpiresAt time.Time
+}
+
+// expired checks if the document is expired at the given time
+func (m Metadata) expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !m.ExpiresAt.After(now)
+}
+
+// Document is a stored value with its revision, the revision increases with every write
+type Document struct {
+	DocKey
+	Envelope
+	Metadata
+	Value    string
+	Revision int64
+}
+
+// KeyMetadata is a listed key with the revision and metadata of its document
+type KeyMetadata struct {
+	Key      string
+	Revision int64
+	Metadata
+}
+
+// keysOf gets the keys of the listed metadata
+func keysOf(metadata []KeyMetadata) []string {
+	keys := make([]string, 0, len(metadata))
+	for _, m := range metadata {
+		keys = append(keys, m.Key)
+	}
+	return keys
+}
+
+// storedMetadata gets the metadata of a stored value with its stored write times and expiry
+func storedMetadata(value string, createdAt int64, updatedAt int64, expiresAt int64) Metadata {
+	return Metadata{
+		CreatedAt: unixTime(createdAt),
+		UpdatedAt: unixTime(updatedAt),
+		Size:      int64(len(value)),
+		ExpiresAt: unixTime(expiresAt),
+	}
+}
+
+// unixTime gets the time of the stored unix nanoseconds, 0 is the zero time
+func unixTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
+// unixNanos gets the stored unix nanoseconds of the time, the zero time is 0
+func unixNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// ProjectUsage is the storage used by the documents of a project, history revisions are not counted
+type ProjectUsage struct {
+	Project string
+	Keys    int
+	Bytes   int64
+}
+
+// ListOptions filters and pages the listed keys of a project, the zero value lists all keys
+type ListOptions struct {
+	// Prefix only lists the keys that start with it
+	Prefix string
+	// After only lists the keys after it, it is the last key of the previous page
+	After string
+	// Limit is the max number of listed keys, 0 means no limit
+	Limit int
+}
+
+// includes checks that the key is listed with the options, ignoring the limit
+func (opts ListOptions) includes(key string) bool {
+	return key > opts.After && strings.HasPrefix(key, opts.Prefix)
+}
+
+// envelopeOf reads the envelope metadata of a stored signed value without verifying its signature,
+// it is used to fill the metadata of documents that are stored before it is recorded
+func envelopeOf(value string) Envelope {
+	signed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(signed) < ed25519.SignatureSize {
+		return Envelope{}
+	}
+
+	var envelope struct {
+		IsEncrypted bool `json:"is_encrypted"`
+		DataVersion int  `json:"data_version"`
+	}
+	if err := json.Unmarshal(signed[ed25519.SignatureSize:], &envelope); err != nil {
+		return Envelope{}
+	}
+
+	return Envelope{IsEncrypted: envelope.IsEncrypted, DataVersion: envelope.DataVersion}
+}
+
+// DefaultHistoryLimit is the default number of kept revisions of each document, including the current one
+const DefaultHistoryLimit = 10
+
+// PkidStore an interface for pkid db store, the context of each operation bounds how long it can take
 type PkidStore interface {
 	SetConn(string) error
-	Migrate() error
-	Get(string) (string, error)
-	Set(string, string) error
-	Update(string, string) error
-	Delete(string) error
-	List() ([]string, error)
+	// SetHistoryLimit sets how many revisions of each document are kept, including the current one
+	SetHistoryLimit(int)
+	// SetClock sets the clock of the write times and expiry of documents, it is time.Now by default
+	SetClock(func() time.Time)
+	Migrate(context.Context) error
+	// Ping checks that the database is reachable
+	Ping(context.Context) error
+	// Migrated checks that all migrations of the store are applied
+	Migrated(context.Context) (bool, error)
+	Get(context.Context, DocKey) (Document, error)
+	// GetRevision gets a kept revision of the document
+	GetRevision(context.Context, DocKey, int64) (Document, error)
+	// History gets the kept revisions of the document, the latest revision first
+	History(context.Context, DocKey) ([]Document, error)
+	// Set writes the document with its expiry and returns its new revision
+	Set(context.Context, Document) (int64, error)
+	// SetIf writes the document only if its current revision is the given revision, revision 0 means it doesn't exist
+	SetIf(context.Context, Document, int64) (int64, error)
+	// SetMany writes the documents in one transaction and returns their new revisions in order,
+	// none of them is written if one of them fails
+	SetMany(context.Context, []Document) ([]int64, error)
+	Update(context.Context, DocKey, string) error
+	Delete(context.Context, DocKey) error
+	DeleteProject(ctx context.Context, pk string, project string) error
+	// DeleteExpired deletes the expired documents with their history and returns the number of deleted documents
+	DeleteExpired(context.Context) (int64, error)
+	List(context.Context) ([]DocKey, error)
+	// Count gets the number of stored keys and of the projects that have them, expired documents are not counted
+	Count(context.Context) (keys int64, projects int64, err error)
+	// ListProject gets the keys of the project that match the options, ordered by key
+	ListProject(ctx context.Context, pk string, project string, opts ListOptions) ([]string, error)
+	// ListMetadata gets the keys of the project that match the options with their metadata, ordered by key
+	ListMetadata(ctx context.Context, pk string, project string, opts ListOptions) ([]KeyMetadata, error)
+	// Usage gets the storage used by each project of the public key, ordered by project
+	Usage(ctx context.Context, pk string) ([]ProjectUsage, error)
 }
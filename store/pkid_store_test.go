@@ -0,0 +1,744 @@
+// package store is for pkid storage
+package store
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testPkidStore is the conformance test suite that every store should pass, conn is a connection to an empty database
+func testPkidStore(t *testing.T, pkidStore PkidStore, conn string) {
+	ctx := context.Background()
+	key := DocKey{Pk: "pk", Project: "project", Key: "key"}
+	emptyKey := DocKey{Pk: "pk", Project: "project"}
+
+	t.Run("test_connection", func(t *testing.T) {
+		err := pkidStore.SetConn(conn)
+
+		if err != nil {
+			t.Errorf("connection should be set")
+		}
+	})
+
+	t.Run("test_migrate", func(t *testing.T) {
+		err := pkidStore.Migrate(ctx)
+		if err != nil {
+			t.Errorf("migration should succeed")
+		}
+	})
+
+	t.Run("test_ready", func(t *testing.T) {
+		if err := pkidStore.Ping(ctx); err != nil {
+			t.Errorf("ping should succeed: %v", err)
+		}
+
+		migrated, err := pkidStore.Migrated(ctx)
+		if err != nil || !migrated {
+			t.Errorf("store should be migrated: %v", err)
+		}
+	})
+
+	t.Run("test_set", func(t *testing.T) {
+		_, err := pkidStore.Set(ctx, Document{DocKey: key, Value: "value"})
+		if err != nil {
+			t.Errorf("set should succeed")
+		}
+	})
+
+	t.Run("test_set_update", func(t *testing.T) {
+		_, err := pkidStore.Set(ctx, Document{DocKey: key, Value: "valueUpdated"})
+		if err != nil {
+			t.Errorf("set should succeed")
+		}
+	})
+
+	t.Run("test_get", func(t *testing.T) {
+		doc, err := pkidStore.Get(ctx, key)
+		if err != nil {
+			t.Errorf("get should not fail: %v", err)
+		}
+
+		if doc.Value != "valueUpdated" {
+			t.Errorf("value of the key should be value")
+		}
+	})
+
+	t.Run("test_list", func(t *testing.T) {
+		keys, err := pkidStore.List(ctx)
+		if err != nil {
+			t.Errorf("list should not fail: %v", err)
+		}
+
+		if len(keys) != 1 {
+			t.Errorf("keys should include one key")
+		}
+	})
+
+	t.Run("test_revision", func(t *testing.T) {
+		doc, err := pkidStore.Get(ctx, key)
+		if err != nil {
+			t.Errorf("get should not fail: %v", err)
+		}
+
+		if doc.Revision != 2 {
+			t.Errorf("revision should be increased with every set, got %d", doc.Revision)
+		}
+	})
+
+	t.Run("test_set_if", func(t *testing.T) {
+		revision, err := pkidStore.SetIf(ctx, Document{DocKey: key, Value: "valueUpdated"}, 2)
+		if err != nil {
+			t.Errorf("set if should succeed: %v", err)
+		}
+
+		if revision != 3 {
+			t.Errorf("revision should be 3, got %d", revision)
+		}
+	})
+
+	t.Run("test_set_if_stale", func(t *testing.T) {
+		_, err := pkidStore.SetIf(ctx, Document{DocKey: key, Value: "stale"}, 2)
+		if !errors.Is(err, ErrRevisionMismatch) {
+			t.Errorf("set if should fail with revision mismatch: %v", err)
+		}
+	})
+
+	t.Run("test_set_if_not_exists", func(t *testing.T) {
+		_, err := pkidStore.SetIf(ctx, Document{DocKey: key, Value: "stale"}, 0)
+		if !errors.Is(err, ErrRevisionMismatch) {
+			t.Errorf("set if should fail with revision mismatch: %v", err)
+		}
+
+		newKey := DocKey{Pk: "pk", Project: "project", Key: "new"}
+		revision, err := pkidStore.SetIf(ctx, Document{DocKey: newKey, Value: "value"}, 0)
+		if err != nil || revision != 1 {
+			t.Errorf("set if should create the document: %v", err)
+		}
+
+		err = pkidStore.Delete(ctx, newKey)
+		if err != nil {
+			t.Errorf("delete should not fail: %v", err)
+		}
+	})
+
+	t.Run("test_set_underscore_key", func(t *testing.T) {
+		underscoreKey := DocKey{Pk: "pk", Project: "project", Key: "my_key"}
+		_, err := pkidStore.Set(ctx, Document{DocKey: underscoreKey, Value: "value"})
+		if err != nil {
+			t.Errorf("set should succeed")
+		}
+
+		keys, err := pkidStore.List(ctx)
+		if err != nil {
+			t.Errorf("list should not fail: %v", err)
+		}
+
+		if len(keys) != 2 {
+			t.Errorf("keys should include two keys")
+		}
+
+		err = pkidStore.Delete(ctx, underscoreKey)
+		if err != nil {
+			t.Errorf("delete should not fail: %v", err)
+		}
+	})
+
+	t.Run("test_set_other_project", func(t *testing.T) {
+		_, err := pkidStore.Set(ctx, Document{DocKey: DocKey{Pk: "pk", Project: "project_key", Key: "key"}, Value: "value"})
+		if err != nil {
+			t.Errorf("set should succeed")
+		}
+
+		doc, err := pkidStore.Get(ctx, key)
+		if err != nil {
+			t.Errorf("get should not fail: %v", err)
+		}
+
+		if doc.Value != "valueUpdated" {
+			t.Errorf("value of the key should not be overwritten by another project")
+		}
+
+		err = pkidStore.Delete(ctx, DocKey{Pk: "pk", Project: "project_key", Key: "key"})
+		if err != nil {
+			t.Errorf("delete should not fail: %v", err)
+		}
+	})
+
+	t.Run("test_list_project", func(t *testing.T) {
+		_, err := pkidStore.Set(ctx, Document{DocKey: DocKey{Pk: "pk", Project: "other", Key: "key"}, Value: "value"})
+		if err != nil {
+			t.Errorf("set should succeed")
+		}
+
+		keys, err := pkidStore.ListProject(ctx, "pk", "project", ListOptions{})
+		if err != nil {
+			t.Errorf("list project should not fail: %v", err)
+		}
+
+		if len(keys) != 1 || keys[0] != "key" {
+			t.Errorf("keys should only include the project key")
+		}
+	})
+
+	t.Run("test_delete_project", func(t *testing.T) {
+		err := pkidStore.DeleteProject(ctx, "pk", "other")
+		if err != nil {
+			t.Errorf("delete project should not fail: %v", err)
+		}
+
+		keys, err := pkidStore.ListProject(ctx, "pk", "other", ListOptions{})
+		if err != nil {
+			t.Errorf("list project should not fail: %v", err)
+		}
+
+		if len(keys) != 0 {
+			t.Errorf("project should be empty")
+		}
+
+		_, err = pkidStore.Get(ctx, key)
+		if err != nil {
+			t.Errorf("other projects should not be deleted: %v", err)
+		}
+	})
+
+	t.Run("test_list_project_empty", func(t *testing.T) {
+		_, err := pkidStore.ListProject(ctx, "pk", "", ListOptions{})
+		if err == nil {
+			t.Errorf("list project should fail")
+		}
+	})
+
+	t.Run("test_delete", func(t *testing.T) {
+		err := pkidStore.Delete(ctx, key)
+		if err != nil {
+			t.Errorf("delete should not fail: %v", err)
+		}
+	})
+
+	t.Run("test_get_deleted", func(t *testing.T) {
+		_, err := pkidStore.Get(ctx, key)
+		if err == nil {
+			t.Errorf("get should fail")
+		}
+	})
+
+	t.Run("test_delete_deleted", func(t *testing.T) {
+		err := pkidStore.Delete(ctx, key)
+		if err == nil {
+			t.Errorf("delete should fail")
+		}
+	})
+
+	t.Run("test_list_empty", func(t *testing.T) {
+		keys, err := pkidStore.List(ctx)
+		if err != nil {
+			t.Errorf("list should not fail: %v", err)
+		}
+
+		if len(keys) > 0 {
+			t.Errorf("list should be empty")
+		}
+	})
+
+	t.Run("test_set_empty", func(t *testing.T) {
+		_, err := pkidStore.Set(ctx, Document{DocKey: emptyKey, Value: "value"})
+		if err == nil {
+			t.Errorf("set should fail")
+		}
+	})
+
+	t.Run("test_set_update_empty", func(t *testing.T) {
+		_, err := pkidStore.Set(ctx, Document{DocKey: emptyKey, Value: "valueUpdated"})
+		if err == nil {
+			t.Errorf("set should fail")
+		}
+	})
+
+	t.Run("test_get_empty", func(t *testing.T) {
+		_, err := pkidStore.Get(ctx, emptyKey)
+		if err == nil {
+			t.Errorf("get should fail")
+		}
+	})
+
+	t.Run("test_delete_empty", func(t *testing.T) {
+		err := pkidStore.Delete(ctx, emptyKey)
+		if err == nil {
+			t.Errorf("delete should fail")
+		}
+	})
+
+	t.Run("test_update_empty", func(t *testing.T) {
+		err := pkidStore.Update(ctx, emptyKey, "value")
+		if err == nil {
+			t.Errorf("update should fail")
+		}
+	})
+
+	t.Run("test_update_empty", func(t *testing.T) {
+		err := pkidStore.Update(ctx, key, "value")
+		if err == nil {
+			t.Errorf("update should fail")
+		}
+	})
+
+	t.Run("test_canceled_context", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := pkidStore.Set(canceled, Document{DocKey: key, Value: "value"})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("set should be canceled, got %v", err)
+		}
+
+		_, err = pkidStore.Get(ctx, key)
+		if !errors.Is(err, ErrNotExists) {
+			t.Errorf("canceled set should not write, got %v", err)
+		}
+
+		_, err = pkidStore.ListProject(canceled, key.Pk, key.Project, ListOptions{})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("list should be canceled, got %v", err)
+		}
+	})
+
+	t.Run("test_usage", func(t *testing.T) {
+		usageKeys := []DocKey{
+			{Pk: "usage", Project: "b", Key: "key"},
+			{Pk: "usage", Project: "a", Key: "key"},
+			{Pk: "usage", Project: "a", Key: "other"},
+		}
+		for _, usageKey := range usageKeys {
+			if _, err := pkidStore.Set(ctx, Document{DocKey: usageKey, Value: "value"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		usage, err := pkidStore.Usage(ctx, "usage")
+		if err != nil {
+			t.Errorf("usage should not fail: %v", err)
+		}
+
+		expected := []ProjectUsage{{Project: "a", Keys: 2, Bytes: 10}, {Project: "b", Keys: 1, Bytes: 5}}
+		if !reflect.DeepEqual(usage, expected) {
+			t.Errorf("usage should be %+v, got %+v", expected, usage)
+		}
+
+		usage, err = pkidStore.Usage(ctx, "nothing")
+		if err != nil || len(usage) != 0 {
+			t.Errorf("usage of an unknown pk should be empty, got %+v: %v", usage, err)
+		}
+
+		for _, usageKey := range usageKeys {
+			if err := pkidStore.Delete(ctx, usageKey); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("test_set_many", func(t *testing.T) {
+		batchKeys := []DocKey{
+			{Pk: "batch", Project: "project", Key: "a"},
+			{Pk: "batch", Project: "project", Key: "b"},
+		}
+		if _, err := pkidStore.Set(ctx, Document{DocKey: batchKeys[1], Value: "old"}); err != nil {
+			t.Fatal(err)
+		}
+
+		revisions, err := pkidStore.SetMany(ctx, []Document{
+			{DocKey: batchKeys[0], Value: "a"},
+			{DocKey: batchKeys[1], Value: "b"},
+		})
+		if err != nil {
+			t.Fatalf("set many should not fail: %v", err)
+		}
+
+		if !reflect.DeepEqual(revisions, []int64{1, 2}) {
+			t.Errorf("revisions should be [1 2], got %v", revisions)
+		}
+
+		doc, err := pkidStore.Get(ctx, batchKeys[1])
+		if err != nil || doc.Value != "b" || doc.Revision != 2 {
+			t.Errorf("set many should update the document, got %+v: %v", doc, err)
+		}
+
+		history, err := pkidStore.History(ctx, batchKeys[1])
+		if err != nil || len(history) != 2 {
+			t.Errorf("set many should record the history, got %+v: %v", history, err)
+		}
+
+		_, err = pkidStore.SetMany(ctx, []Document{
+			{DocKey: batchKeys[0], Value: "new"},
+			{DocKey: DocKey{Pk: "batch", Project: "project"}, Value: "new"},
+		})
+		if err == nil {
+			t.Errorf("set many with an invalid key should fail")
+		}
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err = pkidStore.SetMany(canceled, []Document{{DocKey: batchKeys[0], Value: "new"}})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("set many should be canceled, got %v", err)
+		}
+
+		doc, err = pkidStore.Get(ctx, batchKeys[0])
+		if err != nil || doc.Value != "a" {
+			t.Errorf("failed set many should not write, got %+v: %v", doc, err)
+		}
+
+		for _, batchKey := range batchKeys {
+			if err := pkidStore.Delete(ctx, batchKey); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("test_list_project_options", func(t *testing.T) {
+		for _, k := range []string{"b/2", "a", "b/1", "b", "c"} {
+			if _, err := pkidStore.Set(ctx, Document{DocKey: DocKey{Pk: "list", Project: "project", Key: k}, Value: "value"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cases := []struct {
+			opts ListOptions
+			keys []string
+		}{
+			{ListOptions{}, []string{"a", "b", "b/1", "b/2", "c"}},
+			{ListOptions{Limit: 2}, []string{"a", "b"}},
+			{ListOptions{After: "b", Limit: 2}, []string{"b/1", "b/2"}},
+			{ListOptions{Prefix: "b/"}, []string{"b/1", "b/2"}},
+			{ListOptions{Prefix: "b", After: "b/1"}, []string{"b/2"}},
+			{ListOptions{Prefix: "b/", After: "a"}, []string{"b/1", "b/2"}},
+			{ListOptions{After: "c"}, []string{}},
+			{ListOptions{Prefix: "B"}, []string{}},
+		}
+		for _, c := range cases {
+			keys, err := pkidStore.ListProject(ctx, "list", "project", c.opts)
+			if err != nil {
+				t.Errorf("list project should not fail: %v", err)
+			}
+
+			if !reflect.DeepEqual(keys, c.keys) {
+				t.Errorf("keys of %+v should be %v, got %v", c.opts, c.keys, keys)
+			}
+		}
+
+		if err := pkidStore.DeleteProject(ctx, "list", "project"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("test_envelope", func(t *testing.T) {
+		envelopeKey := DocKey{Pk: "envelope", Project: "project", Key: "key"}
+		envelope := Envelope{IsEncrypted: true, DataVersion: 1}
+
+		_, err := pkidStore.Set(ctx, Document{DocKey: envelopeKey, Envelope: envelope, Value: "value"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		doc, err := pkidStore.Get(ctx, envelopeKey)
+		if err != nil || doc.Envelope != envelope {
+			t.Errorf("envelope should be stored, got %+v: %v", doc.Envelope, err)
+		}
+
+		if err := pkidStore.Update(ctx, envelopeKey, "valueUpdated"); err != nil {
+			t.Fatal(err)
+		}
+
+		docs, err := pkidStore.History(ctx, envelopeKey)
+		if err != nil || len(docs) != 2 || docs[0].Envelope != envelope || docs[1].Envelope != envelope {
+			t.Errorf("envelope should be kept in the history, got %+v: %v", docs, err)
+		}
+
+		if err := pkidStore.Delete(ctx, envelopeKey); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("test_metadata", func(t *testing.T) {
+		metadataKey := DocKey{Pk: "metadata", Project: "project", Key: "key"}
+
+		before := time.Now()
+		if _, err := pkidStore.Set(ctx, Document{DocKey: metadataKey, Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+		after := time.Now()
+
+		created, err := pkidStore.Get(ctx, metadataKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if created.CreatedAt.Before(before) || created.CreatedAt.After(after) || !created.UpdatedAt.Equal(created.CreatedAt) {
+			t.Errorf("write times should be the time of the set, got %+v", created.Metadata)
+		}
+
+		if created.Size != int64(len("value")) {
+			t.Errorf("size should be %d, got %d", len("value"), created.Size)
+		}
+
+		if err := pkidStore.Update(ctx, metadataKey, "valueUpdated"); err != nil {
+			t.Fatal(err)
+		}
+
+		updated, err := pkidStore.Get(ctx, metadataKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !updated.CreatedAt.Equal(created.CreatedAt) || updated.UpdatedAt.Before(created.UpdatedAt) {
+			t.Errorf("created time should be kept and updated time should increase, got %+v then %+v", created.Metadata, updated.Metadata)
+		}
+
+		if updated.Size != int64(len("valueUpdated")) {
+			t.Errorf("size should be %d, got %d", len("valueUpdated"), updated.Size)
+		}
+
+		docs, err := pkidStore.History(ctx, metadataKey)
+		if err != nil || len(docs) != 2 || !docs[1].UpdatedAt.Equal(created.UpdatedAt) || docs[1].Size != created.Size {
+			t.Errorf("metadata should be kept in the history, got %+v: %v", docs, err)
+		}
+
+		metadata, err := pkidStore.ListMetadata(ctx, metadataKey.Pk, metadataKey.Project, ListOptions{})
+		if err != nil || len(metadata) != 1 {
+			t.Fatalf("list metadata should get the key, got %+v: %v", metadata, err)
+		}
+
+		listed := metadata[0]
+		if listed.Key != metadataKey.Key || listed.Revision != updated.Revision || listed.Size != updated.Size ||
+			!listed.CreatedAt.Equal(updated.CreatedAt) || !listed.UpdatedAt.Equal(updated.UpdatedAt) {
+			t.Errorf("listed metadata should be the metadata of the document %+v, got %+v", updated, listed)
+		}
+
+		if err := pkidStore.Delete(ctx, metadataKey); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("test_set_deleted", func(t *testing.T) {
+		deletedKey := DocKey{Pk: "deleted", Project: "project", Key: "key"}
+		for _, value := range []string{"value1", "value2"} {
+			if _, err := pkidStore.Set(ctx, Document{DocKey: deletedKey, Value: value}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := pkidStore.Delete(ctx, deletedKey); err != nil {
+			t.Fatal(err)
+		}
+
+		revision, err := pkidStore.SetIf(ctx, Document{DocKey: deletedKey, Value: "value3"}, 0)
+		if err != nil || revision != 3 {
+			t.Errorf("a deleted document should be written again at the next revision 3, got %d: %v", revision, err)
+		}
+
+		if err := pkidStore.DeleteProject(ctx, deletedKey.Pk, deletedKey.Project); err != nil {
+			t.Fatal(err)
+		}
+
+		revision, err = pkidStore.Set(ctx, Document{DocKey: deletedKey, Value: "value4"})
+		if err != nil || revision != 4 {
+			t.Errorf("a document of a deleted project should be written again at the next revision 4, got %d: %v", revision, err)
+		}
+
+		if _, err := pkidStore.GetRevision(ctx, deletedKey, 2); !errors.Is(err, ErrNotExists) {
+			t.Errorf("revisions of the deleted document should not be got: %v", err)
+		}
+
+		otherKey := DocKey{Pk: deletedKey.Pk, Project: deletedKey.Project, Key: "other"}
+		revision, err = pkidStore.Set(ctx, Document{DocKey: otherKey, Value: "value"})
+		if err != nil || revision != 4 {
+			t.Errorf("a new document should continue from the deleted revisions of its project 3, got %d: %v", revision, err)
+		}
+
+		if err := pkidStore.DeleteProject(ctx, deletedKey.Pk, deletedKey.Project); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("test_expiry", func(t *testing.T) {
+		now := time.Now()
+		pkidStore.SetClock(func() time.Time { return now })
+		defer pkidStore.SetClock(time.Now)
+
+		expiringKey := DocKey{Pk: "expiry", Project: "project", Key: "expiring"}
+		keptKey := DocKey{Pk: "expiry", Project: "project", Key: "kept"}
+
+		keys, projects, err := pkidStore.Count(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expiresAt := now.Add(time.Minute)
+		_, err = pkidStore.SetMany(ctx, []Document{
+			{DocKey: expiringKey, Value: "value", Metadata: Metadata{ExpiresAt: expiresAt}},
+			{DocKey: keptKey, Value: "value"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		doc, err := pkidStore.Get(ctx, expiringKey)
+		if err != nil || !doc.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("document should be got with its expiry %v, got %+v: %v", expiresAt, doc.Metadata, err)
+		}
+
+		// a document that is set again without an expiry never expires
+		unexpiredKey := DocKey{Pk: "unexpired", Project: "project", Key: "key"}
+		if _, err := pkidStore.Set(ctx, Document{DocKey: unexpiredKey, Value: "value", Metadata: Metadata{ExpiresAt: expiresAt}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := pkidStore.Set(ctx, Document{DocKey: unexpiredKey, Value: "value"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if k, p, err := pkidStore.Count(ctx); err != nil || k != keys+3 || p != projects+2 {
+			t.Errorf("count should be %d keys of %d projects, got %d of %d: %v", keys+3, projects+2, k, p, err)
+		}
+
+		now = now.Add(time.Minute)
+
+		if _, err := pkidStore.Get(ctx, expiringKey); !errors.Is(err, ErrNotExists) {
+			t.Errorf("get of an expired document should fail with not exists: %v", err)
+		}
+
+		if k, p, err := pkidStore.Count(ctx); err != nil || k != keys+2 || p != projects+2 {
+			t.Errorf("expired documents should not be counted, got %d keys of %d projects: %v", k, p, err)
+		}
+
+		if _, err := pkidStore.GetRevision(ctx, expiringKey, 1); !errors.Is(err, ErrNotExists) {
+			t.Errorf("get revision of an expired document should fail with not exists: %v", err)
+		}
+
+		if docs, err := pkidStore.History(ctx, expiringKey); err != nil || len(docs) != 0 {
+			t.Errorf("history of an expired document should be empty, got %+v: %v", docs, err)
+		}
+
+		if keys, err := pkidStore.ListProject(ctx, "expiry", "project", ListOptions{}); err != nil || len(keys) != 1 || keys[0] != keptKey.Key {
+			t.Errorf("expired documents should not be listed, got %v: %v", keys, err)
+		}
+
+		if usage, err := pkidStore.Usage(ctx, "expiry"); err != nil || len(usage) != 1 || usage[0].Keys != 1 {
+			t.Errorf("expired documents should not be used, got %+v: %v", usage, err)
+		}
+
+		if err := pkidStore.Delete(ctx, expiringKey); !errors.Is(err, ErrDeleteFailed) {
+			t.Errorf("delete of an expired document should fail: %v", err)
+		}
+
+		if err := pkidStore.Update(ctx, expiringKey, "value"); !errors.Is(err, ErrSetFailed) {
+			t.Errorf("update of an expired document should fail: %v", err)
+		}
+
+		revision, err := pkidStore.SetIf(ctx, Document{DocKey: expiringKey, Value: "replaced", Metadata: Metadata{ExpiresAt: now.Add(time.Minute)}}, 0)
+		if err != nil || revision != 2 {
+			t.Errorf("an expired document should be replaced by a new one at the next revision, got revision %d: %v", revision, err)
+		}
+
+		if docs, err := pkidStore.History(ctx, expiringKey); err != nil || len(docs) != 1 {
+			t.Errorf("history of the expired document should be replaced, got %+v: %v", docs, err)
+		}
+
+		now = now.Add(time.Minute)
+
+		deleted, err := pkidStore.DeleteExpired(ctx)
+		if err != nil || deleted != 1 {
+			t.Errorf("delete expired should delete 1 document, got %d: %v", deleted, err)
+		}
+
+		if deleted, err := pkidStore.DeleteExpired(ctx); err != nil || deleted != 0 {
+			t.Errorf("expired documents should be deleted once, got %d: %v", deleted, err)
+		}
+
+		pkidStore.SetClock(time.Now)
+		if _, err := pkidStore.Get(ctx, expiringKey); !errors.Is(err, ErrNotExists) {
+			t.Errorf("expired document should be deleted: %v", err)
+		}
+
+		if _, err := pkidStore.Get(ctx, unexpiredKey); err != nil {
+			t.Errorf("document set again without an expiry should be kept: %v", err)
+		}
+
+		if err := pkidStore.DeleteProject(ctx, "expiry", "project"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := pkidStore.DeleteProject(ctx, "unexpired", "project"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// testPkidStoreHistory tests the kept revisions of a migrated store
+func testPkidStoreHistory(t *testing.T, pkidStore PkidStore) {
+	ctx := context.Background()
+	pkidStore.SetHistoryLimit(2)
+	defer pkidStore.SetHistoryLimit(DefaultHistoryLimit)
+
+	key := DocKey{Pk: "history", Project: "project", Key: "key"}
+
+	for _, value := range []string{"value1", "value2", "value3"} {
+		if _, err := pkidStore.Set(ctx, Document{DocKey: key, Value: value}); err != nil {
+			t.Fatalf("set should succeed: %v", err)
+		}
+	}
+
+	t.Run("test_history", func(t *testing.T) {
+		docs, err := pkidStore.History(ctx, key)
+		if err != nil {
+			t.Errorf("history should not fail: %v", err)
+		}
+
+		if len(docs) != 2 || docs[0].Revision != 3 || docs[1].Revision != 2 {
+			t.Errorf("history should keep the latest 2 revisions, got %+v", docs)
+		}
+	})
+
+	t.Run("test_get_revision", func(t *testing.T) {
+		doc, err := pkidStore.GetRevision(ctx, key, 2)
+		if err != nil {
+			t.Errorf("get revision should not fail: %v", err)
+		}
+
+		if doc.Value != "value2" {
+			t.Errorf("value of revision 2 should be value2")
+		}
+	})
+
+	t.Run("test_get_pruned_revision", func(t *testing.T) {
+		_, err := pkidStore.GetRevision(ctx, key, 1)
+		if !errors.Is(err, ErrNotExists) {
+			t.Errorf("get revision should fail with not exists: %v", err)
+		}
+	})
+
+	t.Run("test_delete_history", func(t *testing.T) {
+		if err := pkidStore.Delete(ctx, key); err != nil {
+			t.Errorf("delete should not fail: %v", err)
+		}
+
+		docs, err := pkidStore.History(ctx, key)
+		if err != nil {
+			t.Errorf("history should not fail: %v", err)
+		}
+
+		if len(docs) != 0 {
+			t.Errorf("history should be deleted with the document")
+		}
+	})
+}
+
+// signedEnvelope encodes the envelope like a signed value, with an empty signature
+func signedEnvelope(envelope string) string {
+	return base64.StdEncoding.EncodeToString(append(make([]byte, ed25519.SignatureSize), envelope...))
+}
@@ -0,0 +1,105 @@
+// package store is for pkid storage
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// postgresMigrations are applied in order, the schema version of the db is the number of applied migrations
+// and it is kept in pkid_schema table
+var postgresMigrations = []func(*sql.Tx) error{
+	createPostgresTables,
+	addPostgresEnvelopeMetadata,
+	addPostgresWriteTimes,
+	addPostgresExpiry,
+	createPostgresTombstonesTable,
+}
+
+// createPostgresTables creates the documents table with a composite unique key and the history table,
+// keys use the C collation so they are ordered by their bytes like the other stores
+func createPostgresTables(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE pkid(
+        pk TEXT COLLATE "C" NOT NULL,
+        project TEXT COLLATE "C" NOT NULL,
+        key TEXT COLLATE "C" NOT NULL,
+        value TEXT NOT NULL,
+        revision BIGINT NOT NULL DEFAULT 1
+    );
+    CREATE UNIQUE INDEX pkid_doc_key ON pkid(pk, project, key);
+    CREATE TABLE pkid_history(
+        pk TEXT COLLATE "C" NOT NULL,
+        project TEXT COLLATE "C" NOT NULL,
+        key TEXT COLLATE "C" NOT NULL,
+        revision BIGINT NOT NULL,
+        value TEXT NOT NULL
+    );
+    CREATE UNIQUE INDEX pkid_history_revision ON pkid_history(pk, project, key, revision);
+    `)
+	return err
+}
+
+// addPostgresEnvelopeMetadata adds the envelope metadata of the documents and their history,
+// it is read from the stored values
+func addPostgresEnvelopeMetadata(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE pkid ADD COLUMN is_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+    ALTER TABLE pkid ADD COLUMN data_version INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE pkid_history ADD COLUMN is_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+    ALTER TABLE pkid_history ADD COLUMN data_version INTEGER NOT NULL DEFAULT 0;
+    `)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"pkid", "pkid_history"} {
+		err := backfillEnvelopes(
+			tx,
+			fmt.Sprintf("SELECT pk, project, key, revision, value FROM %s", table),
+			fmt.Sprintf("UPDATE %s SET is_encrypted = $1, data_version = $2 WHERE pk = $3 AND project = $4 AND key = $5 AND revision = $6", table),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addPostgresWriteTimes adds the created and updated unix nanoseconds of the documents and their history,
+// they are 0 for the existing rows as their write times are unknown
+func addPostgresWriteTimes(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE pkid ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0;
+    ALTER TABLE pkid ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0;
+    ALTER TABLE pkid_history ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0;
+    ALTER TABLE pkid_history ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0;
+    `)
+	return err
+}
+
+// addPostgresExpiry adds the expiry unix nanoseconds of the documents and their history, 0 never expires,
+// the documents are indexed by it so expired ones are swept without a full scan
+func addPostgresExpiry(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE pkid ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;
+    ALTER TABLE pkid_history ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0;
+    CREATE INDEX pkid_expires_at ON pkid(expires_at);
+    `)
+	return err
+}
+
+// createPostgresTombstonesTable creates the table of the highest revision of the deleted documents of each project,
+// it has a row per project so it doesn't grow with the deleted keys
+func createPostgresTombstonesTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE pkid_tombstones(
+        pk TEXT COLLATE "C" NOT NULL,
+        project TEXT COLLATE "C" NOT NULL,
+        revision BIGINT NOT NULL
+    );
+    CREATE UNIQUE INDEX pkid_tombstones_project ON pkid_tombstones(pk, project);
+    `)
+	return err
+}
@@ -0,0 +1,641 @@
+// package store is for pkid storage
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	// postgres driver
+	_ "github.com/lib/pq"
+)
+
+// postgresMigrationLock is the advisory lock key that makes replicas apply migrations one at a time
+const postgresMigrationLock = 7315
+
+// PostgresStore is a struct for postgres store requirements
+type PostgresStore struct {
+	db           *sql.DB
+	historyLimit int
+	now          func() time.Time
+}
+
+// NewPostgresStore creates a new instance of postgres database
+func NewPostgresStore() *PostgresStore {
+	return &PostgresStore{historyLimit: DefaultHistoryLimit, now: time.Now}
+}
+
+// SetConn sets the connection of the postgres db using its data source name
+func (postgres *PostgresStore) SetConn(dsn string) error {
+	if dsn == "" {
+		return errors.New("no data source name provided")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	postgres.db = db
+	return nil
+}
+
+// SetHistoryLimit sets how many revisions of each document are kept, including the current one
+func (postgres *PostgresStore) SetHistoryLimit(limit int) {
+	postgres.historyLimit = limit
+}
+
+// SetClock sets the clock of the write times and expiry of documents
+func (postgres *PostgresStore) SetClock(now func() time.Time) {
+	postgres.now = now
+}
+
+// Migrate applies the migrations that are not applied yet in one transaction,
+// replicas that migrate at the same time wait for each other
+func (postgres *PostgresStore) Migrate(ctx context.Context) error {
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS pkid_schema(version INTEGER NOT NULL)")
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = tx.QueryRowContext(ctx, "SELECT version FROM pkid_schema").Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.ExecContext(ctx, "INSERT INTO pkid_schema(version) values(0)")
+	}
+	if err != nil {
+		return err
+	}
+
+	for ; version < len(postgresMigrations); version++ {
+		if err := postgresMigrations[version](tx); err != nil {
+			return fmt.Errorf("migration %d failed: %w", version+1, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE pkid_schema SET version = $1", version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Ping checks that the database is reachable
+func (postgres *PostgresStore) Ping(ctx context.Context) error {
+	return postgres.db.PingContext(ctx)
+}
+
+// Migrated checks that all migrations are applied, the database can be migrated further by a newer version
+func (postgres *PostgresStore) Migrated(ctx context.Context) (bool, error) {
+	var version int
+	err := postgres.db.QueryRowContext(ctx, "SELECT version FROM pkid_schema").Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return version >= len(postgresMigrations), nil
+}
+
+// postgresSetQuery upserts a document and increases its revision
+const postgresSetQuery = `
+    INSERT INTO pkid(pk, project, key, value, is_encrypted, data_version, revision, created_at, updated_at, expires_at)
+    values($1, $2, $3, $4, $5, $6, 1, $7, $7, $8)
+    ON CONFLICT(pk, project, key) DO UPDATE SET
+        value = excluded.value,
+        is_encrypted = excluded.is_encrypted,
+        data_version = excluded.data_version,
+        updated_at = excluded.updated_at,
+        expires_at = excluded.expires_at,
+        revision = pkid.revision + 1
+    RETURNING revision
+    `
+
+// Set adds a new row with key and value or updates the existing one and increases its revision
+func (postgres *PostgresStore) Set(ctx context.Context, doc Document) (int64, error) {
+	if !doc.valid() {
+		return 0, errors.New("invalid key")
+	}
+
+	now := postgres.now().UnixNano()
+	return postgres.write(ctx, doc.DocKey, postgresSetQuery,
+		doc.Pk, doc.Project, doc.Key, doc.Value, doc.IsEncrypted, doc.DataVersion, now, unixNanos(doc.ExpiresAt),
+	)
+}
+
+// SetMany adds or updates the rows of all documents in one transaction
+func (postgres *PostgresStore) SetMany(ctx context.Context, docs []Document) ([]int64, error) {
+	for _, doc := range docs {
+		if !doc.valid() {
+			return nil, errors.New("invalid key")
+		}
+	}
+
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := postgres.now().UnixNano()
+	revisions := make([]int64, 0, len(docs))
+	for _, doc := range docs {
+		revision, err := postgres.writeTx(ctx, tx, doc.DocKey, postgresSetQuery,
+			doc.Pk, doc.Project, doc.Key, doc.Value, doc.IsEncrypted, doc.DataVersion, now, unixNanos(doc.ExpiresAt),
+		)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, tx.Commit()
+}
+
+// SetIf sets the row only if its current revision is the given revision,
+// revision 0 means the row should not exist
+func (postgres *PostgresStore) SetIf(ctx context.Context, doc Document, revision int64) (int64, error) {
+	if !doc.valid() {
+		return 0, errors.New("invalid key")
+	}
+
+	now := postgres.now().UnixNano()
+	var newRevision int64
+	var err error
+	if revision == 0 {
+		newRevision, err = postgres.write(ctx, doc.DocKey, `
+        INSERT INTO pkid(pk, project, key, value, is_encrypted, data_version, revision, created_at, updated_at, expires_at)
+        values($1, $2, $3, $4, $5, $6, 1, $7, $7, $8)
+        ON CONFLICT(pk, project, key) DO NOTHING
+        RETURNING revision
+        `, doc.Pk, doc.Project, doc.Key, doc.Value, doc.IsEncrypted, doc.DataVersion, now, unixNanos(doc.ExpiresAt))
+	} else {
+		newRevision, err = postgres.write(ctx, doc.DocKey, `
+        UPDATE pkid SET value = $1, is_encrypted = $2, data_version = $3, updated_at = $4, expires_at = $5, revision = revision + 1
+        WHERE pk = $6 AND project = $7 AND key = $8 AND revision = $9
+        RETURNING revision
+        `, doc.Value, doc.IsEncrypted, doc.DataVersion, now, unixNanos(doc.ExpiresAt), doc.Pk, doc.Project, doc.Key, revision)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrRevisionMismatch
+	}
+
+	return newRevision, err
+}
+
+// write runs the given write query of the document that returns the written revision,
+// and copies the written document to the history in the same transaction
+func (postgres *PostgresStore) write(ctx context.Context, key DocKey, query string, args ...interface{}) (int64, error) {
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	revision, err := postgres.writeTx(ctx, tx, key, query, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	return revision, tx.Commit()
+}
+
+// writeTx runs the write query of the document and records it in the history with the given transaction,
+// an expired document is deleted first so it is written as a new one. The caller rolls back the transaction if it fails
+func (postgres *PostgresStore) writeTx(ctx context.Context, tx *sql.Tx, key DocKey, query string, args ...interface{}) (int64, error) {
+	now := postgres.now().UnixNano()
+	err := postgres.tombstoneTx(ctx, tx,
+		"pk = $1 AND project = $2 AND key = $3 AND expires_at != 0 AND expires_at <= $4",
+		key.Pk, key.Project, key.Key, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+    DELETE FROM pkid_history WHERE pk = $1 AND project = $2 AND key = $3
+    AND EXISTS (SELECT 1 FROM pkid WHERE pk = $1 AND project = $2 AND key = $3 AND expires_at != 0 AND expires_at <= $4)
+    `, key.Pk, key.Project, key.Key, now)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM pkid WHERE pk = $1 AND project = $2 AND key = $3 AND expires_at != 0 AND expires_at <= $4",
+		key.Pk, key.Project, key.Key, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var revision int64
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&revision); err != nil {
+		return 0, err
+	}
+
+	if revision == 1 {
+		revision, err = postgres.continueRevisionTx(ctx, tx, key)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+    INSERT INTO pkid_history(pk, project, key, revision, value, is_encrypted, data_version, created_at, updated_at, expires_at)
+    SELECT pk, project, key, revision, value, is_encrypted, data_version, created_at, updated_at, expires_at FROM pkid WHERE pk = $1 AND project = $2 AND key = $3
+    `, key.Pk, key.Project, key.Key)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM pkid_history WHERE pk = $1 AND project = $2 AND key = $3 AND revision <= $4",
+		key.Pk, key.Project, key.Key, revision-int64(postgres.historyLimit),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+// tombstoneTx raises the tombstone revision of the projects of the documents that match the condition
+// to their highest revision before they are deleted, so the documents written later in the project never reuse it
+func (postgres *PostgresStore) tombstoneTx(ctx context.Context, tx *sql.Tx, condition string, args ...interface{}) error {
+	_, err := tx.ExecContext(ctx, `
+    INSERT INTO pkid_tombstones(pk, project, revision)
+    SELECT pk, project, MAX(revision) FROM pkid WHERE `+condition+` GROUP BY pk, project
+    ON CONFLICT(pk, project) DO UPDATE SET revision = GREATEST(pkid_tombstones.revision, excluded.revision)
+    `, args...)
+	return err
+}
+
+// continueRevisionTx continues the revision of a newly created document from the tombstone of its project
+// if it has one, and returns the revision of the document
+func (postgres *PostgresStore) continueRevisionTx(ctx context.Context, tx *sql.Tx, key DocKey) (int64, error) {
+	var last int64
+	err := tx.QueryRowContext(ctx,
+		"SELECT revision FROM pkid_tombstones WHERE pk = $1 AND project = $2",
+		key.Pk, key.Project,
+	).Scan(&last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE pkid SET revision = $1 WHERE pk = $2 AND project = $3 AND key = $4",
+		last+1, key.Pk, key.Project, key.Key,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return last + 1, nil
+}
+
+// Get gets the document of the given key
+func (postgres *PostgresStore) Get(ctx context.Context, key DocKey) (Document, error) {
+	if !key.valid() {
+		return Document{}, errors.New("invalid key")
+	}
+
+	row := postgres.db.QueryRowContext(ctx,
+		`SELECT value, revision, is_encrypted, data_version, created_at, updated_at, expires_at FROM pkid
+        WHERE pk = $1 AND project = $2 AND key = $3 AND (expires_at = 0 OR expires_at > $4)`,
+		key.Pk, key.Project, key.Key, postgres.now().UnixNano(),
+	)
+
+	doc := Document{DocKey: key}
+	var createdAt, updatedAt, expiresAt int64
+	if err := row.Scan(&doc.Value, &doc.Revision, &doc.IsEncrypted, &doc.DataVersion, &createdAt, &updatedAt, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Document{}, ErrNotExists
+		}
+		return Document{}, err
+	}
+
+	doc.Metadata = storedMetadata(doc.Value, createdAt, updatedAt, expiresAt)
+	return doc, nil
+}
+
+// GetRevision gets the given revision of the document from its history
+func (postgres *PostgresStore) GetRevision(ctx context.Context, key DocKey, revision int64) (Document, error) {
+	if !key.valid() {
+		return Document{}, errors.New("invalid key")
+	}
+
+	row := postgres.db.QueryRowContext(ctx,
+		`SELECT h.value, h.is_encrypted, h.data_version, h.created_at, h.updated_at, h.expires_at FROM pkid_history h
+        JOIN pkid d ON d.pk = h.pk AND d.project = h.project AND d.key = h.key
+        WHERE h.pk = $1 AND h.project = $2 AND h.key = $3 AND h.revision = $4 AND (d.expires_at = 0 OR d.expires_at > $5)`,
+		key.Pk, key.Project, key.Key, revision, postgres.now().UnixNano(),
+	)
+
+	doc := Document{DocKey: key, Revision: revision}
+	var createdAt, updatedAt, expiresAt int64
+	if err := row.Scan(&doc.Value, &doc.IsEncrypted, &doc.DataVersion, &createdAt, &updatedAt, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Document{}, ErrNotExists
+		}
+		return Document{}, err
+	}
+
+	doc.Metadata = storedMetadata(doc.Value, createdAt, updatedAt, expiresAt)
+	return doc, nil
+}
+
+// History gets the kept revisions of the document, the latest revision first
+func (postgres *PostgresStore) History(ctx context.Context, key DocKey) ([]Document, error) {
+	if !key.valid() {
+		return nil, errors.New("invalid key")
+	}
+
+	rows, err := postgres.db.QueryContext(ctx,
+		`SELECT h.revision, h.value, h.is_encrypted, h.data_version, h.created_at, h.updated_at, h.expires_at FROM pkid_history h
+        JOIN pkid d ON d.pk = h.pk AND d.project = h.project AND d.key = h.key
+        WHERE h.pk = $1 AND h.project = $2 AND h.key = $3 AND (d.expires_at = 0 OR d.expires_at > $4) ORDER BY h.revision DESC`,
+		key.Pk, key.Project, key.Key, postgres.now().UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []Document{}
+	for rows.Next() {
+		doc := Document{DocKey: key}
+		var createdAt, updatedAt, expiresAt int64
+		if err := rows.Scan(&doc.Revision, &doc.Value, &doc.IsEncrypted, &doc.DataVersion, &createdAt, &updatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+
+		doc.Metadata = storedMetadata(doc.Value, createdAt, updatedAt, expiresAt)
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// Update updates a row with key and value
+func (postgres *PostgresStore) Update(ctx context.Context, key DocKey, value string) error {
+	if !key.valid() {
+		return errors.New("invalid updated ID")
+	}
+
+	_, err := postgres.write(ctx,
+		key,
+		"UPDATE pkid SET value = $1, updated_at = $2, revision = revision + 1 WHERE pk = $3 AND project = $4 AND key = $5 RETURNING revision",
+		value, postgres.now().UnixNano(), key.Pk, key.Project, key.Key,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSetFailed
+	}
+
+	return err
+}
+
+// Delete deletes the value of the given key with its history
+func (postgres *PostgresStore) Delete(ctx context.Context, key DocKey) error {
+	if !key.valid() {
+		return errors.New("invalid key")
+	}
+
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	now := postgres.now().UnixNano()
+	err = postgres.tombstoneTx(ctx, tx,
+		"pk = $1 AND project = $2 AND key = $3 AND (expires_at = 0 OR expires_at > $4)",
+		key.Pk, key.Project, key.Key, now,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"DELETE FROM pkid WHERE pk = $1 AND project = $2 AND key = $3 AND (expires_at = 0 OR expires_at > $4)",
+		key.Pk, key.Project, key.Key, now,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if rowsAffected == 0 {
+		_ = tx.Rollback()
+		return ErrDeleteFailed
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM pkid_history WHERE pk = $1 AND project = $2 AND key = $3",
+		key.Pk, key.Project, key.Key,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteProject deletes all keys of the given project with their history in one transaction
+func (postgres *PostgresStore) DeleteProject(ctx context.Context, pk string, project string) error {
+	if pk == "" || project == "" {
+		return errors.New("invalid project")
+	}
+
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := postgres.tombstoneTx(ctx, tx, "pk = $1 AND project = $2", pk, project); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM pkid WHERE pk = $1 AND project = $2", pk, project)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM pkid_history WHERE pk = $1 AND project = $2", pk, project)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpired deletes the expired documents with their history in one transaction
+func (postgres *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	now := postgres.now().UnixNano()
+	if err := postgres.tombstoneTx(ctx, tx, "expires_at != 0 AND expires_at <= $1", now); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+    DELETE FROM pkid_history WHERE (pk, project, key) IN (
+        SELECT pk, project, key FROM pkid WHERE expires_at != 0 AND expires_at <= $1
+    )`, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM pkid WHERE expires_at != 0 AND expires_at <= $1", now)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
+}
+
+// List gets all keys
+func (postgres *PostgresStore) List(ctx context.Context) ([]DocKey, error) {
+	rows, err := postgres.db.QueryContext(ctx,
+		"SELECT pk, project, key FROM pkid WHERE expires_at = 0 OR expires_at > $1",
+		postgres.now().UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []DocKey
+	for rows.Next() {
+		var key DocKey
+		if err := rows.Scan(&key.Pk, &key.Project, &key.Key); err != nil {
+			return nil, err
+		}
+
+		all = append(all, key)
+	}
+	return all, rows.Err()
+}
+
+// Count gets the number of stored keys and of the projects that have them
+func (postgres *PostgresStore) Count(ctx context.Context) (keys int64, projects int64, err error) {
+	err = postgres.db.QueryRowContext(ctx, `
+    SELECT COALESCE(SUM(keys), 0), COUNT(*) FROM (
+        SELECT COUNT(*) AS keys FROM pkid WHERE expires_at = 0 OR expires_at > $1 GROUP BY pk, project
+    ) AS projects`, postgres.now().UnixNano()).Scan(&keys, &projects)
+	return
+}
+
+// ListProject gets the keys of the given project that match the options ordered by key,
+// keys are compared byte by byte as their collation is "C"
+func (postgres *PostgresStore) ListProject(ctx context.Context, pk string, project string, opts ListOptions) ([]string, error) {
+	metadata, err := postgres.ListMetadata(ctx, pk, project, opts)
+	if err != nil {
+		return nil, err
+	}
+	return keysOf(metadata), nil
+}
+
+// ListMetadata gets the keys of the given project that match the options with their metadata ordered by key,
+// keys are compared byte by byte as their collation is "C"
+func (postgres *PostgresStore) ListMetadata(ctx context.Context, pk string, project string, opts ListOptions) ([]KeyMetadata, error) {
+	if pk == "" || project == "" {
+		return nil, errors.New("invalid project")
+	}
+
+	// a null limit has no limit
+	limit := sql.NullInt64{Int64: int64(opts.Limit), Valid: opts.Limit > 0}
+
+	rows, err := postgres.db.QueryContext(ctx, `
+    SELECT key, revision, created_at, updated_at, expires_at, OCTET_LENGTH(value) FROM pkid
+    WHERE pk = $1 AND project = $2 AND key > $3 AND left(key, length($4)) = $4 AND (expires_at = 0 OR expires_at > $5)
+    ORDER BY key LIMIT $6
+    `, pk, project, opts.After, opts.Prefix, postgres.now().UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := []KeyMetadata{}
+	for rows.Next() {
+		var m KeyMetadata
+		var createdAt, updatedAt, expiresAt int64
+		if err := rows.Scan(&m.Key, &m.Revision, &createdAt, &updatedAt, &expiresAt, &m.Size); err != nil {
+			return nil, err
+		}
+
+		m.CreatedAt = unixTime(createdAt)
+		m.UpdatedAt = unixTime(updatedAt)
+		m.ExpiresAt = unixTime(expiresAt)
+		metadata = append(metadata, m)
+	}
+	return metadata, rows.Err()
+}
+
+// Usage gets the storage used by each project of the public key, ordered by project
+func (postgres *PostgresStore) Usage(ctx context.Context, pk string) ([]ProjectUsage, error) {
+	if pk == "" {
+		return nil, errors.New("invalid public key")
+	}
+
+	rows, err := postgres.db.QueryContext(ctx,
+		`SELECT project, COUNT(*), SUM(OCTET_LENGTH(value)) FROM pkid
+        WHERE pk = $1 AND (expires_at = 0 OR expires_at > $2) GROUP BY project ORDER BY project`,
+		pk, postgres.now().UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []ProjectUsage{}
+	for rows.Next() {
+		var project ProjectUsage
+		if err := rows.Scan(&project.Project, &project.Keys, &project.Bytes); err != nil {
+			return nil, err
+		}
+
+		usage = append(usage, project)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,42 @@
+// package store is for pkid storage
+package store
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+// postgresTestDSN is the environment variable of a disposable postgres database for the store tests,
+// its pkid tables are dropped before the tests
+const postgresTestDSN = "PKID_TEST_POSTGRES_DSN"
+
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv(postgresTestDSN)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresTestDSN)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("DROP TABLE IF EXISTS pkid, pkid_history, pkid_tombstones, pkid_schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	pkidStore := NewPostgresStore()
+	t.Run("test_empty_conn", func(t *testing.T) {
+		err := pkidStore.SetConn("")
+
+		if err == nil {
+			t.Errorf("connection should not be set")
+		}
+	})
+
+	testPkidStore(t, pkidStore, dsn)
+	testPkidStoreHistory(t, pkidStore)
+}
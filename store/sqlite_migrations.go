@@ -0,0 +1,217 @@
+// package store is for pkid storage
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sqliteMigrations are applied in order, the schema version of the db is the number of applied migrations
+// and it is kept in sqlite user_version pragma
+var sqliteMigrations = []func(*sql.Tx) error{
+	createKeyValueTable,
+	splitDocumentKeys,
+	addRevisions,
+	createHistoryTable,
+	addEnvelopeMetadata,
+	addWriteTimes,
+	addExpiry,
+	createTombstonesTable,
+}
+
+// createKeyValueTable creates the first pkid table includes 2 columns for key and value, key is unique
+func createKeyValueTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE IF NOT EXISTS pkid(
+        key TEXT NOT NULL UNIQUE,
+        value TEXT NOT NULL
+    );
+    `)
+	return err
+}
+
+// splitDocumentKeys moves the concatenated `pk_project_key` keys into separate columns
+// with a composite unique index
+func splitDocumentKeys(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE pkid RENAME TO pkid_legacy;
+    CREATE TABLE pkid(
+        pk TEXT NOT NULL,
+        project TEXT NOT NULL,
+        key TEXT NOT NULL,
+        value TEXT NOT NULL
+    );
+    CREATE UNIQUE INDEX pkid_doc_key ON pkid(pk, project, key);
+    `)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT key, value FROM pkid_legacy")
+	if err != nil {
+		return err
+	}
+
+	type legacyRow struct {
+		key   DocKey
+		value string
+	}
+
+	var legacyRows []legacyRow
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		legacyRows = append(legacyRows, legacyRow{key: splitLegacyKey(key), value: value})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, row := range legacyRows {
+		_, err := tx.Exec(
+			"INSERT INTO pkid(pk, project, key, value) values(?,?,?,?)",
+			row.key.Pk, row.key.Project, row.key.Key, row.value,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to migrate key %+v: %w", row.key, err)
+		}
+	}
+
+	_, err = tx.Exec("DROP TABLE pkid_legacy")
+	return err
+}
+
+// splitLegacyKey splits a legacy `pk_project_key` key at its first two separators, so an ambiguous
+// key keeps the rest of the underscores. Keys that can't be split are kept as they are in the pk column
+func splitLegacyKey(legacyKey string) DocKey {
+	parts := strings.SplitN(legacyKey, "_", 3)
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return DocKey{Pk: legacyKey}
+	}
+
+	return DocKey{Pk: parts[0], Project: parts[1], Key: parts[2]}
+}
+
+// addRevisions adds the revision of each document, existing documents start at revision 1
+func addRevisions(tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE pkid ADD COLUMN revision INTEGER NOT NULL DEFAULT 1")
+	return err
+}
+
+// createHistoryTable creates the table of the kept revisions of each document, it starts with the current revisions
+func createHistoryTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE pkid_history(
+        pk TEXT NOT NULL,
+        project TEXT NOT NULL,
+        key TEXT NOT NULL,
+        revision INTEGER NOT NULL,
+        value TEXT NOT NULL
+    );
+    CREATE UNIQUE INDEX pkid_history_revision ON pkid_history(pk, project, key, revision);
+    INSERT INTO pkid_history(pk, project, key, revision, value) SELECT pk, project, key, revision, value FROM pkid;
+    `)
+	return err
+}
+
+// addEnvelopeMetadata adds the envelope metadata of the documents and their history,
+// it is read from the stored values
+func addEnvelopeMetadata(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE pkid ADD COLUMN is_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+    ALTER TABLE pkid ADD COLUMN data_version INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE pkid_history ADD COLUMN is_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+    ALTER TABLE pkid_history ADD COLUMN data_version INTEGER NOT NULL DEFAULT 0;
+    `)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"pkid", "pkid_history"} {
+		err := backfillEnvelopes(
+			tx,
+			fmt.Sprintf("SELECT pk, project, key, revision, value FROM %s", table),
+			fmt.Sprintf("UPDATE %s SET is_encrypted = ?, data_version = ? WHERE pk = ? AND project = ? AND key = ? AND revision = ?", table),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backfillEnvelopes sets the envelope metadata of the rows of the select query from their values,
+// the update query gets the metadata then the pk, project, key and revision of the row
+func backfillEnvelopes(tx *sql.Tx, selectQuery string, updateQuery string) error {
+	rows, err := tx.Query(selectQuery)
+	if err != nil {
+		return err
+	}
+
+	var docs []Document
+	for rows.Next() {
+		var doc Document
+		if err := rows.Scan(&doc.Pk, &doc.Project, &doc.Key, &doc.Revision, &doc.Value); err != nil {
+			rows.Close()
+			return err
+		}
+		docs = append(docs, doc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		envelope := envelopeOf(doc.Value)
+		_, err := tx.Exec(updateQuery, envelope.IsEncrypted, envelope.DataVersion, doc.Pk, doc.Project, doc.Key, doc.Revision)
+		if err != nil {
+			return fmt.Errorf("failed to migrate key %+v: %w", doc.DocKey, err)
+		}
+	}
+
+	return nil
+}
+
+// addWriteTimes adds the created and updated unix nanoseconds of the documents and their history,
+// they are 0 for the existing rows as their write times are unknown
+func addWriteTimes(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE pkid ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE pkid ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE pkid_history ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE pkid_history ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+    `)
+	return err
+}
+
+// addExpiry adds the expiry unix nanoseconds of the documents and their history, 0 never expires,
+// the documents are indexed by it so expired ones are swept without a full scan
+func addExpiry(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE pkid ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE pkid_history ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;
+    CREATE INDEX pkid_expires_at ON pkid(expires_at);
+    `)
+	return err
+}
+
+// createTombstonesTable creates the table of the highest revision of the deleted documents of each project,
+// it has a row per project so it doesn't grow with the deleted keys
+func createTombstonesTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE pkid_tombstones(
+        pk TEXT NOT NULL,
+        project TEXT NOT NULL,
+        revision INTEGER NOT NULL
+    );
+    CREATE UNIQUE INDEX pkid_tombstones_project ON pkid_tombstones(pk, project);
+    `)
+	return err
+}
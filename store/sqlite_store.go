@@ -2,10 +2,14 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
-	sqlite3 "github.com/mattn/go-sqlite3"
+	// sqlite driver
+	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
@@ -15,16 +19,20 @@ var (
 	ErrSetFailed = errors.New("set failed")
 	// ErrDeleteFailed is an error when deleting data fails
 	ErrDeleteFailed = errors.New("deletion failed")
+	// ErrRevisionMismatch is an error when a conditional set doesn't match the current revision
+	ErrRevisionMismatch = errors.New("revision mismatch")
 )
 
 // SqliteStore is a struct for sqlite store requirements
 type SqliteStore struct {
-	db *sql.DB
+	db           *sql.DB
+	historyLimit int
+	now          func() time.Time
 }
 
 // NewSqliteStore creates a new instance of sqlite database
 func NewSqliteStore() *SqliteStore {
-	return &SqliteStore{}
+	return &SqliteStore{historyLimit: DefaultHistoryLimit, now: time.Now}
 }
 
 // SetConn sets the connection and filePath of the sqlite db
@@ -41,127 +49,585 @@ func (sqlite *SqliteStore) SetConn(filePath string) error {
 	return nil
 }
 
-// Migrate creates a new table includes 2 columns for key and value, key is unique
-func (sqlite *SqliteStore) Migrate() error {
-	query := `
-    CREATE TABLE IF NOT EXISTS pkid(
-        key TEXT NOT NULL UNIQUE,
-        value TEXT NOT NULL
-    );
+// SetHistoryLimit sets how many revisions of each document are kept, including the current one
+func (sqlite *SqliteStore) SetHistoryLimit(limit int) {
+	sqlite.historyLimit = limit
+}
+
+// SetClock sets the clock of the write times and expiry of documents
+func (sqlite *SqliteStore) SetClock(now func() time.Time) {
+	sqlite.now = now
+}
+
+// Migrate applies the migrations that are not applied yet, each one in its own transaction
+func (sqlite *SqliteStore) Migrate(ctx context.Context) error {
+	var version int
+	if err := sqlite.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := sqlite.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if err := sqliteMigrations[version](tx); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version+1, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ping checks that the database is reachable
+func (sqlite *SqliteStore) Ping(ctx context.Context) error {
+	return sqlite.db.PingContext(ctx)
+}
+
+// Migrated checks that all migrations are applied, the database can be migrated further by a newer version
+func (sqlite *SqliteStore) Migrated(ctx context.Context) (bool, error) {
+	var version int
+	if err := sqlite.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return false, err
+	}
+
+	return version >= len(sqliteMigrations), nil
+}
+
+// sqliteSetQuery upserts a document and increases its revision
+const sqliteSetQuery = `
+    INSERT INTO pkid(pk, project, key, value, is_encrypted, data_version, revision, created_at, updated_at, expires_at) values(?,?,?,?,?,?,1,?,?,?)
+    ON CONFLICT(pk, project, key) DO UPDATE SET
+        value = excluded.value,
+        is_encrypted = excluded.is_encrypted,
+        data_version = excluded.data_version,
+        updated_at = excluded.updated_at,
+        expires_at = excluded.expires_at,
+        revision = pkid.revision + 1
+    RETURNING revision
     `
-	_, err := sqlite.db.Exec(query)
-	return err
+
+// Set adds a new row with key and value or updates the existing one and increases its revision
+func (sqlite *SqliteStore) Set(ctx context.Context, doc Document) (int64, error) {
+	if !doc.valid() {
+		return 0, errors.New("invalid key")
+	}
+
+	now := sqlite.now().UnixNano()
+	return sqlite.write(ctx, doc.DocKey, sqliteSetQuery,
+		doc.Pk, doc.Project, doc.Key, doc.Value, doc.IsEncrypted, doc.DataVersion, now, now, unixNanos(doc.ExpiresAt),
+	)
 }
 
-// Set adds a new row with key and value
-func (sqlite *SqliteStore) Set(key string, value string) error {
-	if key == "" {
-		return errors.New("invalid key")
+// SetMany adds or updates the rows of all documents in one transaction
+func (sqlite *SqliteStore) SetMany(ctx context.Context, docs []Document) ([]int64, error) {
+	for _, doc := range docs {
+		if !doc.valid() {
+			return nil, errors.New("invalid key")
+		}
 	}
 
-	res, err := sqlite.db.Exec("INSERT INTO pkid(key, value) values(?,?)", key, value)
+	tx, err := sqlite.db.BeginTx(ctx, nil)
 	if err != nil {
-		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr) {
-			if errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
-				return sqlite.Update(key, value)
-			}
+		return nil, err
+	}
+
+	now := sqlite.now().UnixNano()
+	revisions := make([]int64, 0, len(docs))
+	for _, doc := range docs {
+		revision, err := sqlite.writeTx(ctx, tx, doc.DocKey, sqliteSetQuery,
+			doc.Pk, doc.Project, doc.Key, doc.Value, doc.IsEncrypted, doc.DataVersion, now, now, unixNanos(doc.ExpiresAt),
+		)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
 		}
-		return err
+
+		revisions = append(revisions, revision)
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	return revisions, tx.Commit()
+}
+
+// SetIf sets the row only if its current revision is the given revision,
+// revision 0 means the row should not exist
+func (sqlite *SqliteStore) SetIf(ctx context.Context, doc Document, revision int64) (int64, error) {
+	if !doc.valid() {
+		return 0, errors.New("invalid key")
+	}
+
+	now := sqlite.now().UnixNano()
+	var newRevision int64
+	var err error
+	if revision == 0 {
+		newRevision, err = sqlite.write(ctx, doc.DocKey, `
+        INSERT INTO pkid(pk, project, key, value, is_encrypted, data_version, revision, created_at, updated_at, expires_at) values(?,?,?,?,?,?,1,?,?,?)
+        ON CONFLICT(pk, project, key) DO NOTHING
+        RETURNING revision
+        `, doc.Pk, doc.Project, doc.Key, doc.Value, doc.IsEncrypted, doc.DataVersion, now, now, unixNanos(doc.ExpiresAt))
+	} else {
+		newRevision, err = sqlite.write(ctx, doc.DocKey, `
+        UPDATE pkid SET value = ?, is_encrypted = ?, data_version = ?, updated_at = ?, expires_at = ?, revision = revision + 1
+        WHERE pk = ? AND project = ? AND key = ? AND revision = ?
+        RETURNING revision
+        `, doc.Value, doc.IsEncrypted, doc.DataVersion, now, unixNanos(doc.ExpiresAt), doc.Pk, doc.Project, doc.Key, revision)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrRevisionMismatch
+	}
+
+	return newRevision, err
+}
+
+// write runs the given write query of the document that returns the written revision,
+// and copies the written document to the history in the same transaction
+func (sqlite *SqliteStore) write(ctx context.Context, key DocKey, query string, args ...interface{}) (int64, error) {
+	tx, err := sqlite.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if rowsAffected == 0 {
-		return ErrSetFailed
+	revision, err := sqlite.writeTx(ctx, tx, key, query, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
 	}
 
-	return nil
+	return revision, tx.Commit()
+}
+
+// writeTx runs the write query of the document and records it in the history with the given transaction,
+// an expired document is deleted first so it is written as a new one. The caller rolls back the transaction if it fails
+func (sqlite *SqliteStore) writeTx(ctx context.Context, tx *sql.Tx, key DocKey, query string, args ...interface{}) (int64, error) {
+	now := sqlite.now().UnixNano()
+	err := sqlite.tombstoneTx(ctx, tx,
+		"pk = ? AND project = ? AND key = ? AND expires_at != 0 AND expires_at <= ?",
+		key.Pk, key.Project, key.Key, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+    DELETE FROM pkid_history WHERE pk = ? AND project = ? AND key = ?
+    AND EXISTS (SELECT 1 FROM pkid WHERE pk = ? AND project = ? AND key = ? AND expires_at != 0 AND expires_at <= ?)
+    `, key.Pk, key.Project, key.Key, key.Pk, key.Project, key.Key, now)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM pkid WHERE pk = ? AND project = ? AND key = ? AND expires_at != 0 AND expires_at <= ?",
+		key.Pk, key.Project, key.Key, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var revision int64
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&revision); err != nil {
+		return 0, err
+	}
+
+	if revision == 1 {
+		revision, err = sqlite.continueRevisionTx(ctx, tx, key)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+    INSERT INTO pkid_history(pk, project, key, revision, value, is_encrypted, data_version, created_at, updated_at, expires_at)
+    SELECT pk, project, key, revision, value, is_encrypted, data_version, created_at, updated_at, expires_at FROM pkid WHERE pk = ? AND project = ? AND key = ?
+    `, key.Pk, key.Project, key.Key)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM pkid_history WHERE pk = ? AND project = ? AND key = ? AND revision <= ?",
+		key.Pk, key.Project, key.Key, revision-int64(sqlite.historyLimit),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, nil
 }
 
-// Get gets the value of the given key
-func (sqlite *SqliteStore) Get(key string) (string, error) {
-	if key == "" {
-		return "", errors.New("invalid key")
+// tombstoneTx raises the tombstone revision of the projects of the documents that match the condition
+// to their highest revision before they are deleted, so the documents written later in the project never reuse it
+func (sqlite *SqliteStore) tombstoneTx(ctx context.Context, tx *sql.Tx, condition string, args ...interface{}) error {
+	_, err := tx.ExecContext(ctx, `
+    INSERT INTO pkid_tombstones(pk, project, revision)
+    SELECT pk, project, MAX(revision) FROM pkid WHERE `+condition+` GROUP BY pk, project
+    ON CONFLICT(pk, project) DO UPDATE SET revision = MAX(pkid_tombstones.revision, excluded.revision)
+    `, args...)
+	return err
+}
+
+// continueRevisionTx continues the revision of a newly created document from the tombstone of its project
+// if it has one, and returns the revision of the document
+func (sqlite *SqliteStore) continueRevisionTx(ctx context.Context, tx *sql.Tx, key DocKey) (int64, error) {
+	var last int64
+	err := tx.QueryRowContext(ctx,
+		"SELECT revision FROM pkid_tombstones WHERE pk = ? AND project = ?",
+		key.Pk, key.Project,
+	).Scan(&last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
 	}
 
-	row := sqlite.db.QueryRow("SELECT * FROM pkid WHERE key = ?", key)
+	_, err = tx.ExecContext(ctx,
+		"UPDATE pkid SET revision = ? WHERE pk = ? AND project = ? AND key = ?",
+		last+1, key.Pk, key.Project, key.Key,
+	)
+	if err != nil {
+		return 0, err
+	}
 
-	var value string
-	if err := row.Scan(&key, &value); err != nil {
+	return last + 1, nil
+}
+
+// Get gets the document of the given key
+func (sqlite *SqliteStore) Get(ctx context.Context, key DocKey) (Document, error) {
+	if !key.valid() {
+		return Document{}, errors.New("invalid key")
+	}
+
+	row := sqlite.db.QueryRowContext(ctx,
+		`SELECT value, revision, is_encrypted, data_version, created_at, updated_at, expires_at FROM pkid
+        WHERE pk = ? AND project = ? AND key = ? AND (expires_at = 0 OR expires_at > ?)`,
+		key.Pk, key.Project, key.Key, sqlite.now().UnixNano(),
+	)
+
+	doc := Document{DocKey: key}
+	var createdAt, updatedAt, expiresAt int64
+	if err := row.Scan(&doc.Value, &doc.Revision, &doc.IsEncrypted, &doc.DataVersion, &createdAt, &updatedAt, &expiresAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", ErrNotExists
+			return Document{}, ErrNotExists
 		}
-		return "", err
+		return Document{}, err
 	}
-	return value, nil
+
+	doc.Metadata = storedMetadata(doc.Value, createdAt, updatedAt, expiresAt)
+	return doc, nil
+}
+
+// GetRevision gets the given revision of the document from its history
+func (sqlite *SqliteStore) GetRevision(ctx context.Context, key DocKey, revision int64) (Document, error) {
+	if !key.valid() {
+		return Document{}, errors.New("invalid key")
+	}
+
+	row := sqlite.db.QueryRowContext(ctx,
+		`SELECT h.value, h.is_encrypted, h.data_version, h.created_at, h.updated_at, h.expires_at FROM pkid_history h
+        JOIN pkid d ON d.pk = h.pk AND d.project = h.project AND d.key = h.key
+        WHERE h.pk = ? AND h.project = ? AND h.key = ? AND h.revision = ? AND (d.expires_at = 0 OR d.expires_at > ?)`,
+		key.Pk, key.Project, key.Key, revision, sqlite.now().UnixNano(),
+	)
+
+	doc := Document{DocKey: key, Revision: revision}
+	var createdAt, updatedAt, expiresAt int64
+	if err := row.Scan(&doc.Value, &doc.IsEncrypted, &doc.DataVersion, &createdAt, &updatedAt, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Document{}, ErrNotExists
+		}
+		return Document{}, err
+	}
+
+	doc.Metadata = storedMetadata(doc.Value, createdAt, updatedAt, expiresAt)
+	return doc, nil
+}
+
+// History gets the kept revisions of the document, the latest revision first
+func (sqlite *SqliteStore) History(ctx context.Context, key DocKey) ([]Document, error) {
+	if !key.valid() {
+		return nil, errors.New("invalid key")
+	}
+
+	rows, err := sqlite.db.QueryContext(ctx,
+		`SELECT h.revision, h.value, h.is_encrypted, h.data_version, h.created_at, h.updated_at, h.expires_at FROM pkid_history h
+        JOIN pkid d ON d.pk = h.pk AND d.project = h.project AND d.key = h.key
+        WHERE h.pk = ? AND h.project = ? AND h.key = ? AND (d.expires_at = 0 OR d.expires_at > ?) ORDER BY h.revision DESC`,
+		key.Pk, key.Project, key.Key, sqlite.now().UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []Document{}
+	for rows.Next() {
+		doc := Document{DocKey: key}
+		var createdAt, updatedAt, expiresAt int64
+		if err := rows.Scan(&doc.Revision, &doc.Value, &doc.IsEncrypted, &doc.DataVersion, &createdAt, &updatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+
+		doc.Metadata = storedMetadata(doc.Value, createdAt, updatedAt, expiresAt)
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
 }
 
 // Update updates a row with key and value
-func (sqlite *SqliteStore) Update(key string, value string) error {
-	if key == "" {
+func (sqlite *SqliteStore) Update(ctx context.Context, key DocKey, value string) error {
+	if !key.valid() {
 		return errors.New("invalid updated ID")
 	}
-	res, err := sqlite.db.Exec("UPDATE pkid SET value = ?", value)
+
+	_, err := sqlite.write(ctx,
+		key,
+		"UPDATE pkid SET value = ?, updated_at = ?, revision = revision + 1 WHERE pk = ? AND project = ? AND key = ? RETURNING revision",
+		value, sqlite.now().UnixNano(), key.Pk, key.Project, key.Key,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSetFailed
+	}
+
+	return err
+}
+
+// Delete deletes the value of the given key with its history
+func (sqlite *SqliteStore) Delete(ctx context.Context, key DocKey) error {
+	if !key.valid() {
+		return errors.New("invalid key")
+	}
+
+	tx, err := sqlite.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	now := sqlite.now().UnixNano()
+	err = sqlite.tombstoneTx(ctx, tx,
+		"pk = ? AND project = ? AND key = ? AND (expires_at = 0 OR expires_at > ?)",
+		key.Pk, key.Project, key.Key, now,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"DELETE FROM pkid WHERE pk = ? AND project = ? AND key = ? AND (expires_at = 0 OR expires_at > ?)",
+		key.Pk, key.Project, key.Key, now,
+	)
 	if err != nil {
+		_ = tx.Rollback()
 		return err
 	}
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
+		_ = tx.Rollback()
 		return err
 	}
 
 	if rowsAffected == 0 {
-		return ErrSetFailed
+		_ = tx.Rollback()
+		return ErrDeleteFailed
 	}
 
-	return nil
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM pkid_history WHERE pk = ? AND project = ? AND key = ?",
+		key.Pk, key.Project, key.Key,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// Delete deletes the value of the given key
-func (sqlite *SqliteStore) Delete(key string) error {
-	if key == "" {
-		return errors.New("invalid key")
+// DeleteProject deletes all keys of the given project with their history in one transaction
+func (sqlite *SqliteStore) DeleteProject(ctx context.Context, pk string, project string) error {
+	if pk == "" || project == "" {
+		return errors.New("invalid project")
 	}
 
-	res, err := sqlite.db.Exec("DELETE FROM pkid WHERE key = ?", key)
+	tx, err := sqlite.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	if err := sqlite.tombstoneTx(ctx, tx, "pk = ? AND project = ?", pk, project); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM pkid WHERE pk = ? AND project = ?", pk, project)
 	if err != nil {
+		_ = tx.Rollback()
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrDeleteFailed
+	_, err = tx.ExecContext(ctx, "DELETE FROM pkid_history WHERE pk = ? AND project = ?", pk, project)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
 	}
 
-	return err
+	return tx.Commit()
+}
+
+// DeleteExpired deletes the expired documents with their history in one transaction
+func (sqlite *SqliteStore) DeleteExpired(ctx context.Context) (int64, error) {
+	tx, err := sqlite.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	now := sqlite.now().UnixNano()
+	if err := sqlite.tombstoneTx(ctx, tx, "expires_at != 0 AND expires_at <= ?", now); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+    DELETE FROM pkid_history WHERE (pk, project, key) IN (
+        SELECT pk, project, key FROM pkid WHERE expires_at != 0 AND expires_at <= ?
+    )`, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM pkid WHERE expires_at != 0 AND expires_at <= ?", now)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
 }
 
 // List gets all keys
-func (sqlite *SqliteStore) List() ([]string, error) {
-	rows, err := sqlite.db.Query("SELECT * FROM pkid")
+func (sqlite *SqliteStore) List(ctx context.Context) ([]DocKey, error) {
+	rows, err := sqlite.db.QueryContext(ctx,
+		"SELECT pk, project, key FROM pkid WHERE expires_at = 0 OR expires_at > ?",
+		sqlite.now().UnixNano(),
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var all []string
+	var all []DocKey
 	for rows.Next() {
-		var key string
-		var value string
-		if err := rows.Scan(&key, &value); err != nil {
+		var key DocKey
+		if err := rows.Scan(&key.Pk, &key.Project, &key.Key); err != nil {
 			return nil, err
 		}
 
 		all = append(all, key)
 	}
-	return all, nil
+	return all, rows.Err()
+}
+
+// Count gets the number of stored keys and of the projects that have them
+func (sqlite *SqliteStore) Count(ctx context.Context) (keys int64, projects int64, err error) {
+	err = sqlite.db.QueryRowContext(ctx, `
+    SELECT COALESCE(SUM(keys), 0), COUNT(*) FROM (
+        SELECT COUNT(*) AS keys FROM pkid WHERE expires_at = 0 OR expires_at > ? GROUP BY pk, project
+    )`, sqlite.now().UnixNano()).Scan(&keys, &projects)
+	return
+}
+
+// ListProject gets the keys of the given project that match the options ordered by key
+func (sqlite *SqliteStore) ListProject(ctx context.Context, pk string, project string, opts ListOptions) ([]string, error) {
+	metadata, err := sqlite.ListMetadata(ctx, pk, project, opts)
+	if err != nil {
+		return nil, err
+	}
+	return keysOf(metadata), nil
+}
+
+// ListMetadata gets the keys of the given project that match the options with their metadata ordered by key
+func (sqlite *SqliteStore) ListMetadata(ctx context.Context, pk string, project string, opts ListOptions) ([]KeyMetadata, error) {
+	if pk == "" || project == "" {
+		return nil, errors.New("invalid project")
+	}
+
+	// a negative limit has no limit
+	limit := -1
+	if opts.Limit > 0 {
+		limit = opts.Limit
+	}
+
+	rows, err := sqlite.db.QueryContext(ctx, `
+    SELECT key, revision, created_at, updated_at, expires_at, LENGTH(CAST(value AS BLOB)) FROM pkid
+    WHERE pk = ? AND project = ? AND key > ? AND substr(key, 1, length(?)) = ? AND (expires_at = 0 OR expires_at > ?)
+    ORDER BY key LIMIT ?
+    `, pk, project, opts.After, opts.Prefix, opts.Prefix, sqlite.now().UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := []KeyMetadata{}
+	for rows.Next() {
+		var m KeyMetadata
+		var createdAt, updatedAt, expiresAt int64
+		if err := rows.Scan(&m.Key, &m.Revision, &createdAt, &updatedAt, &expiresAt, &m.Size); err != nil {
+			return nil, err
+		}
+
+		m.CreatedAt = unixTime(createdAt)
+		m.UpdatedAt = unixTime(updatedAt)
+		m.ExpiresAt = unixTime(expiresAt)
+		metadata = append(metadata, m)
+	}
+	return metadata, rows.Err()
+}
+
+// Usage gets the storage used by each project of the public key, ordered by project
+func (sqlite *SqliteStore) Usage(ctx context.Context, pk string) ([]ProjectUsage, error) {
+	if pk == "" {
+		return nil, errors.New("invalid public key")
+	}
+
+	rows, err := sqlite.db.QueryContext(ctx,
+		`SELECT project, COUNT(*), SUM(LENGTH(CAST(value AS BLOB))) FROM pkid
+        WHERE pk = ? AND (expires_at = 0 OR expires_at > ?) GROUP BY project ORDER BY project`,
+		pk, sqlite.now().UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []ProjectUsage{}
+	for rows.Next() {
+		var project ProjectUsage
+		if err := rows.Scan(&project.Project, &project.Keys, &project.Bytes); err != nil {
+			return nil, err
+		}
+
+		usage = append(usage, project)
+	}
+	return usage, rows.Err()
 }
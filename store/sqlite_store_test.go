@@ -1,13 +1,17 @@
+//go:build cgo
+
 // package store is for pkid storage
 package store
 
-import "testing"
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
 
-func TestPkidStore(t *testing.T) {
-	testDir := t.TempDir()
+func TestSqliteStore(t *testing.T) {
 	pkidStore := NewSqliteStore()
-
-	t.Run("test_empty_file", func(t *testing.T) {
+	t.Run("test_empty_conn", func(t *testing.T) {
 		err := pkidStore.SetConn("")
 
 		if err == nil {
@@ -15,128 +19,131 @@ func TestPkidStore(t *testing.T) {
 		}
 	})
 
-	t.Run("test_connection", func(t *testing.T) {
-		err := pkidStore.SetConn(testDir + "/pkid.db")
-
-		if err != nil {
-			t.Errorf("connection should be set")
-		}
-	})
-
-	t.Run("test_migrate", func(t *testing.T) {
-		err := pkidStore.Migrate()
-		if err != nil {
-			t.Errorf("migration should succeed")
-		}
-	})
-
-	t.Run("test_set", func(t *testing.T) {
-		err := pkidStore.Set("key", "value")
-		if err != nil {
-			t.Errorf("set should succeed")
-		}
-	})
-
-	t.Run("test_set_update", func(t *testing.T) {
-		err := pkidStore.Set("key", "valueUpdated")
-		if err != nil {
-			t.Errorf("set should succeed")
-		}
-	})
-
-	t.Run("test_get", func(t *testing.T) {
-		value, err := pkidStore.Get("key")
-		if err != nil {
-			t.Errorf("get should not fail: %v", err)
-		}
-
-		if value != "valueUpdated" {
-			t.Errorf("value of the key should be value")
-		}
-	})
-
-	t.Run("test_list", func(t *testing.T) {
-		keys, err := pkidStore.List()
-		if err != nil {
-			t.Errorf("list should not fail: %v", err)
-		}
-
-		if len(keys) != 1 {
-			t.Errorf("keys should include one key")
-		}
-	})
-
-	t.Run("test_delete", func(t *testing.T) {
-		err := pkidStore.Delete("key")
-		if err != nil {
-			t.Errorf("delete should not fail: %v", err)
-		}
-	})
-
-	t.Run("test_get_deleted", func(t *testing.T) {
-		_, err := pkidStore.Get("key")
-		if err == nil {
-			t.Errorf("get should fail")
-		}
-	})
-
-	t.Run("test_delete_deleted", func(t *testing.T) {
-		err := pkidStore.Delete("key")
-		if err == nil {
-			t.Errorf("delete should fail")
-		}
-	})
-
-	t.Run("test_list_empty", func(t *testing.T) {
-		keys, err := pkidStore.List()
-		if err != nil {
-			t.Errorf("list should not fail: %v", err)
-		}
+	testPkidStore(t, pkidStore, t.TempDir()+"/pkid.db")
+	testPkidStoreHistory(t, pkidStore)
+}
 
-		if len(keys) > 0 {
-			t.Errorf("list should be empty")
-		}
-	})
+func TestSqliteMigrateLegacyKeys(t *testing.T) {
+	ctx := context.Background()
+	dbFile := t.TempDir() + "/pkid.db"
 
-	t.Run("test_set_empty", func(t *testing.T) {
-		err := pkidStore.Set("", "value")
-		if err == nil {
-			t.Errorf("set should fail")
-		}
-	})
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	t.Run("test_set_update_empty", func(t *testing.T) {
-		err := pkidStore.Set("", "valueUpdated")
-		if err == nil {
-			t.Errorf("set should fail")
-		}
-	})
+	_, err = db.Exec(`
+    CREATE TABLE pkid(key TEXT NOT NULL UNIQUE, value TEXT NOT NULL);
+    INSERT INTO pkid(key, value) values('pk_project_key', 'value'), ('pk_project_my_key', 'value2'), ('broken', 'value3');
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
 
-	t.Run("test_get_empty", func(t *testing.T) {
-		_, err := pkidStore.Get("")
-		if err == nil {
-			t.Errorf("get should fail")
-		}
-	})
+	pkidStore := NewSqliteStore()
+	if err := pkidStore.SetConn(dbFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if migrated, err := pkidStore.Migrated(ctx); err != nil || migrated {
+		t.Errorf("legacy database should not be migrated: %v", err)
+	}
+
+	if err := pkidStore.Migrate(ctx); err != nil {
+		t.Fatalf("migration should succeed: %v", err)
+	}
+
+	if migrated, err := pkidStore.Migrated(ctx); err != nil || !migrated {
+		t.Errorf("database should be migrated: %v", err)
+	}
+
+	doc, err := pkidStore.Get(ctx, DocKey{Pk: "pk", Project: "project", Key: "key"})
+	if err != nil || doc.Value != "value" || doc.Revision != 1 {
+		t.Errorf("migrated key should be found: %v", err)
+	}
+
+	doc, err = pkidStore.Get(ctx, DocKey{Pk: "pk", Project: "project", Key: "my_key"})
+	if err != nil || doc.Value != "value2" {
+		t.Errorf("migrated underscore key should be found: %v", err)
+	}
+
+	keys, err := pkidStore.List(ctx)
+	if err != nil {
+		t.Errorf("list should not fail: %v", err)
+	}
+
+	if len(keys) != 3 {
+		t.Errorf("no rows should be lost in migration, got %d", len(keys))
+	}
+
+	if err := pkidStore.Migrate(ctx); err != nil {
+		t.Errorf("migrating again should succeed: %v", err)
+	}
+}
 
-	t.Run("test_delete_empty", func(t *testing.T) {
-		err := pkidStore.Delete("")
-		if err == nil {
-			t.Errorf("delete should fail")
-		}
-	})
+func TestSqliteMigrateEnvelopes(t *testing.T) {
+	ctx := context.Background()
+	dbFile := t.TempDir() + "/pkid.db"
+
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the schema before the envelope metadata
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range sqliteMigrations[:4] {
+		if err := migration(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	value := signedEnvelope(`{"is_encrypted": true, "payload": "value", "data_version": 1}`)
+	_, err = tx.Exec(`
+    PRAGMA user_version = 4;
+    INSERT INTO pkid(pk, project, key, value) values('pk', 'project', 'key', ?), ('pk', 'project', 'broken', 'broken');
+    INSERT INTO pkid_history(pk, project, key, revision, value) values('pk', 'project', 'key', 1, ?);
+    `, value, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
 
-	t.Run("test_update_empty", func(t *testing.T) {
-		err := pkidStore.Update("", "value")
-		if err == nil {
-			t.Errorf("update should fail")
-		}
-	})
-
-	t.Run("test_update_empty", func(t *testing.T) {
-		err := pkidStore.Update("key", "value")
-		if err == nil {
-			t.Errorf("update should fail")
-		}
-	})
+	pkidStore := NewSqliteStore()
+	if err := pkidStore.SetConn(dbFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pkidStore.Migrate(ctx); err != nil {
+		t.Fatalf("migration should succeed: %v", err)
+	}
+
+	envelope := Envelope{IsEncrypted: true, DataVersion: 1}
+	doc, err := pkidStore.Get(ctx, DocKey{Pk: "pk", Project: "project", Key: "key"})
+	if err != nil || doc.Envelope != envelope {
+		t.Errorf("envelope should be read from the value, got %+v: %v", doc.Envelope, err)
+	}
+
+	doc, err = pkidStore.GetRevision(ctx, DocKey{Pk: "pk", Project: "project", Key: "key"}, 1)
+	if err != nil || doc.Envelope != envelope {
+		t.Errorf("envelope of the history should be read from the value, got %+v: %v", doc.Envelope, err)
+	}
+
+	doc, err = pkidStore.Get(ctx, DocKey{Pk: "pk", Project: "project", Key: "broken"})
+	if err != nil || doc.Envelope != (Envelope{}) {
+		t.Errorf("envelope of an invalid value should be unknown, got %+v: %v", doc.Envelope, err)
+	}
+
+	if !doc.CreatedAt.IsZero() || !doc.UpdatedAt.IsZero() || doc.Size != int64(len("broken")) {
+		t.Errorf("write times of a migrated document should be unknown, got %+v", doc.Metadata)
+	}
 }